@@ -0,0 +1,164 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Errors returned while decoding chunked request bodies
+var (
+	ErrMalformedChunk              = errors.New("malformed chunked encoding")
+	ErrUnsupportedTransferEncoding = errors.New("unsupported transfer encoding")
+)
+
+// chunkedReader decodes a body sent with "Transfer-Encoding: chunked"
+// Chunk extensions are ignored and trailer fields are collected in trailer
+type chunkedReader struct {
+	r        *bufio.Reader
+	n        uint64 // bytes left in the current chunk
+	checkEnd bool   // chunk data was read, CRLF has to follow
+	trailer  Header
+	err      error
+}
+
+// newChunkedReader returns a reader that de-chunks data from r
+func newChunkedReader(r *bufio.Reader) *chunkedReader {
+	return &chunkedReader{
+		r:       r,
+		trailer: make(Header),
+	}
+}
+
+// Read reads de-chunked payload, io.EOF is returned after the last chunk and trailers
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	for cr.err == nil {
+		if cr.checkEnd {
+			cr.readChunkEnd()
+			continue
+		}
+
+		if cr.n == 0 {
+			cr.beginChunk()
+			continue
+		}
+
+		if len(p) == 0 {
+			return 0, nil
+		}
+
+		// Don't read past the current chunk
+		if uint64(len(p)) > cr.n {
+			p = p[:cr.n]
+		}
+		n, err := cr.r.Read(p)
+		cr.n -= uint64(n)
+		if cr.n == 0 {
+			cr.checkEnd = true
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		cr.err = err
+		return n, err
+	}
+
+	return 0, cr.err
+}
+
+// beginChunk reads the chunk-size line, the last chunk also reads trailers
+func (cr *chunkedReader) beginChunk() {
+	line, err := readChunkLine(cr.r)
+	if err != nil {
+		cr.err = err
+		return
+	}
+
+	// Skip chunk extensions
+	size, _, _ := bytes.Cut(line, []byte(";"))
+	size = bytes.TrimSpace(size)
+	cr.n, err = strconv.ParseUint(string(size), 16, 63)
+	if err != nil {
+		cr.err = fmt.Errorf("%w: invalid chunk size %q", ErrMalformedChunk, size)
+		return
+	}
+
+	if cr.n == 0 {
+		cr.err = cr.readTrailer()
+		if cr.err == nil {
+			cr.err = io.EOF
+		}
+	}
+}
+
+// readChunkEnd reads CRLF that terminates chunk data
+func (cr *chunkedReader) readChunkEnd() {
+	var end [2]byte
+	if _, err := io.ReadFull(cr.r, end[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		cr.err = err
+		return
+	}
+
+	if string(end[:]) != CRLF {
+		cr.err = fmt.Errorf("%w: missing CRLF after chunk data", ErrMalformedChunk)
+		return
+	}
+	cr.checkEnd = false
+}
+
+// readTrailer reads trailer fields until the empty line
+// Trailer is limited to maxHeaderBytes like the request head
+func (cr *chunkedReader) readTrailer() error {
+	size := 0
+	for {
+		line, err := readChunkLine(cr.r)
+		if err != nil {
+			return err
+		}
+		if len(line) == 0 {
+			return nil
+		}
+		if size += len(line) + len(CRLF); size > maxHeaderBytes {
+			return fmt.Errorf("%w: trailer exceeds %d bytes", ErrMalformedChunk, maxHeaderBytes)
+		}
+
+		key, value, err := parseHeaderLine(line)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrMalformedChunk, err)
+		}
+		cr.trailer.Add(key, value)
+	}
+}
+
+// readChunkLine reads a single CRLF terminated line without the CRLF
+func readChunkLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err == bufio.ErrBufferFull {
+			return nil, fmt.Errorf("%w: line too long", ErrMalformedChunk)
+		}
+		return nil, err
+	}
+
+	if !bytes.HasSuffix(line, []byte(CRLF)) {
+		return nil, fmt.Errorf("%w: line not terminated with CRLF", ErrMalformedChunk)
+	}
+
+	return line[:len(line)-len(CRLF)], nil
+}
+
+// isChunked reports whether Transfer-Encoding value is exactly "chunked"
+// Other codings are not supported by the server
+func isChunked(transferEncoding string) bool {
+	return strings.EqualFold(strings.TrimSpace(transferEncoding), "chunked")
+}
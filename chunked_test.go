@@ -0,0 +1,162 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestChunkedReader(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		trailer map[string]string
+		err     error
+	}{
+		{
+			name:  "single chunk",
+			input: "5\r\nhello\r\n0\r\n\r\n",
+			want:  "hello",
+		},
+		{
+			name:  "multiple chunks with CRLF in data",
+			input: "7\r\nhello\r\n\r\n6\r\nworld!\r\n0\r\n\r\n",
+			want:  "hello\r\nworld!",
+		},
+		{
+			name:  "hex sizes and extensions",
+			input: "A;name=value\r\n0123456789\r\n1 ; ext\r\n!\r\n0;last\r\n\r\n",
+			want:  "0123456789!",
+		},
+		{
+			name:    "trailers",
+			input:   "3\r\nabc\r\n0\r\nExpires: never\r\nChecksum: 123\r\n\r\n",
+			want:    "abc",
+			trailer: map[string]string{"Expires": "never", "Checksum": "123"},
+		},
+		{
+			name:  "invalid chunk size",
+			input: "zz\r\nabc\r\n0\r\n\r\n",
+			err:   ErrMalformedChunk,
+		},
+		{
+			name:  "missing CRLF after data",
+			input: "3\r\nabcd\r\n0\r\n\r\n",
+			err:   ErrMalformedChunk,
+		},
+		{
+			name:  "line without CR",
+			input: "3\nabc\r\n0\r\n\r\n",
+			err:   ErrMalformedChunk,
+		},
+		{
+			name:  "invalid trailer",
+			input: "0\r\ninvalid\r\n\r\n",
+			err:   ErrMalformedChunk,
+		},
+		{
+			name:  "trailer too large",
+			input: "0\r\n" + strings.Repeat("X-Filler: "+strings.Repeat("a", 1000)+"\r\n", maxHeaderBytes/1000) + "\r\n",
+			err:   ErrMalformedChunk,
+		},
+		{
+			name:  "truncated data",
+			input: "a\r\nabc",
+			err:   io.ErrUnexpectedEOF,
+		},
+		{
+			name:  "missing last chunk",
+			input: "3\r\nabc\r\n",
+			err:   io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := newChunkedReader(bufio.NewReader(strings.NewReader(tt.input)))
+			got, err := io.ReadAll(cr)
+
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Expected error %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+			for k, v := range tt.trailer {
+				if cr.trailer.Get(k) != v {
+					t.Errorf("Expected trailer %s to be %q, got %q", k, v, cr.trailer.Get(k))
+				}
+			}
+		})
+	}
+}
+
+func TestParseRequestChunked(t *testing.T) {
+	t.Run("chunked body", func(t *testing.T) {
+		server, _ := MockConnParts(
+			"POST /upload HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n",
+			"5\r\nhello\r\n",
+			"6\r\n world\r\n0\r\nChecksum: 42\r\n\r\n",
+		)
+		defer server.Close()
+
+		got, err := ParseRequest(server, readTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got.Body) != "hello world" {
+			t.Errorf("Expected body %q, got %q", "hello world", got.Body)
+		}
+		if got.Trailers.Get("Checksum") != "42" {
+			t.Errorf("Expected trailer Checksum to be 42, got %q", got.Trailers.Get("Checksum"))
+		}
+	})
+
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{
+			name:  "unknown transfer coding",
+			input: "POST /upload HTTP/1.1\r\nTransfer-Encoding: gzip, chunked\r\n\r\n",
+			want:  ErrUnsupportedTransferEncoding,
+		},
+		{
+			name:  "malformed chunk",
+			input: "POST /upload HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nxyz\r\n",
+			want:  ErrMalformedChunk,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := MockConn(tt.input)
+			defer server.Close()
+
+			_, err := ParseRequest(server, readTimeout)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected error %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	t.Run("both Content-Length and Transfer-Encoding", func(t *testing.T) {
+		server, _ := MockConn("POST /upload HTTP/1.1\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n0\r\n\r\n")
+		defer server.Close()
+
+		if _, err := ParseRequest(server, readTimeout); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	})
+}
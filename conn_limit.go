@@ -0,0 +1,186 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+// ConnLimitPolicy decides what happens to connections over Server.MaxConnections
+type ConnLimitPolicy int
+
+const (
+	// ConnLimitWait holds accepted connection until another one closes,
+	// further clients wait in the listen backlog
+	ConnLimitWait ConnLimitPolicy = iota
+
+	// ConnLimitReject accepts the connection and answers it with 503 Service Unavailable
+	ConnLimitReject
+)
+
+// Reasons passed to Server.Overloaded
+var (
+	ErrTooManyConnections       = errors.New("too many connections")
+	ErrTooManyClientConnections = errors.New("too many connections from client")
+)
+
+// Delay between failed accepts doubles up to maxAcceptDelay
+const (
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+)
+
+// Rejected connections are answered by at most maxRejecting goroutines,
+// each of them holds the connection for rejectTimeout at most
+const (
+	maxRejecting  = 64
+	rejectTimeout = time.Second
+)
+
+// acceptConnSlot takes a slot for a new connection, it waits for one if block is set
+// Returns false if there's no free slot or the server is shutting down
+func (s *Server) acceptConnSlot(block bool) bool {
+	slots := s.connSlots()
+	if slots == nil {
+		return true
+	}
+
+	if block {
+		select {
+		case slots <- struct{}{}:
+			return true
+		case <-s.serverCtx.Done():
+			return false
+		}
+	}
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseConnSlot frees slot taken by acceptConnSlot
+func (s *Server) releaseConnSlot() {
+	if slots := s.connSlots(); slots != nil {
+		<-slots
+	}
+}
+
+// connSlots returns semaphore of MaxConnections size or nil if there's no limit
+func (s *Server) connSlots() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.MaxConnections <= 0 {
+		return nil
+	}
+	if s.slots == nil {
+		s.slots = make(chan struct{}, s.MaxConnections)
+	}
+	return s.slots
+}
+
+// addClientConn counts conn for its client IP
+// Returns false if the client already has MaxConnsPerIP connections
+func (s *Server) addClientConn(conn net.Conn) bool {
+	ip := clientIP(conn)
+	if s.MaxConnsPerIP <= 0 || ip == "" {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clientConns[ip] >= s.MaxConnsPerIP {
+		return false
+	}
+	if s.clientConns == nil {
+		s.clientConns = make(map[string]int)
+	}
+	s.clientConns[ip]++
+	return true
+}
+
+// removeClientConn stops counting conn for its client IP
+func (s *Server) removeClientConn(conn net.Conn) {
+	ip := clientIP(conn)
+	if s.MaxConnsPerIP <= 0 || ip == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clientConns[ip]--; s.clientConns[ip] <= 0 {
+		delete(s.clientConns, ip)
+	}
+}
+
+// releaseConn frees limits taken by conn once it's closed
+func (s *Server) releaseConn(conn net.Conn) {
+	s.removeClientConn(conn)
+	s.releaseConnSlot()
+}
+
+// reject answers conn over the connection limits in the background
+// When maxRejecting connections are already being answered, conn is closed right away
+func (s *Server) reject(conn net.Conn, code int, reason error) {
+	if s.rejecting.Add(1) > maxRejecting {
+		s.rejecting.Add(-1)
+		log.Printf("Dropping connection from %s: %v", conn.RemoteAddr(), reason)
+		conn.Close()
+		s.wg.Done()
+		return
+	}
+	go s.rejectConn(conn, code, reason)
+}
+
+// rejectConn answers the first request of conn with the Overloaded handler and closes it
+// Request is read first, so the client gets the response instead of a reset connection
+func (s *Server) rejectConn(conn net.Conn, code int, reason error) {
+	defer s.wg.Done()
+	defer s.rejecting.Add(-1)
+	defer conn.Close()
+
+	log.Printf("Rejecting connection from %s: %v", conn.RemoteAddr(), reason)
+	// The whole exchange shares one short deadline
+	conn.SetReadDeadline(time.Now().Add(rejectTimeout))
+	readRequest(bufio.NewReader(conn))
+
+	s.writeError(NewResponseWriter(conn, rejectTimeout), nil, code, reason)
+
+	// Rest of the request is drained after closing our side, so it doesn't reset the response
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		io.Copy(io.Discard, io.LimitReader(conn, maxDrainBytes))
+	}
+}
+
+// clientIP returns IP address of the conn peer or "" for non IP connections
+func clientIP(conn net.Conn) string {
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		return addr.IP.String()
+	case *net.UDPAddr:
+		return addr.IP.String()
+	}
+	return ""
+}
+
+// nextAcceptDelay returns how long to wait after another failed accept
+func nextAcceptDelay(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return minAcceptDelay
+	}
+	return min(2*delay, maxAcceptDelay)
+}
+
+// isTemporary reports whether accept may succeed later,
+// like when the process runs out of file descriptors
+func isTemporary(err error) bool {
+	var temp interface{ Temporary() bool }
+	return errors.As(err, &temp) && temp.Temporary()
+}
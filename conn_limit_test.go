@@ -0,0 +1,284 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// keptAliveConn returns connection that got a response and stays open
+func keptAliveConn(t *testing.T, port int) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("GET /hello HTTP/1.1\r\n\r\n"))
+	if status, _, _ := readResponse(t, bufio.NewReader(conn)); status != "HTTP/1.1 200 OK" {
+		t.Fatalf("Expected 200 for the first connection, got %q", status)
+	}
+	return conn
+}
+
+// limitRouter returns router answering GET /hello
+func limitRouter() *HTTPRouter {
+	router := NewHTTPRouter()
+	router.HandlerFunc("GET", "/hello", func(r *HTTPRequest, w ResponseWriter) {
+		w.Write([]byte("hello"))
+	})
+	return router
+}
+
+func TestMaxConnectionsReject(t *testing.T) {
+	reasons := make(chan error, 1)
+	s, port := startTestServer(t, limitRouter(), func(s *Server) {
+		s.MaxConnections = 1
+		s.ConnLimit = ConnLimitReject
+		s.Overloaded = func(r *HTTPRequest, w ResponseWriter, code int, err error) {
+			reasons <- err
+			DefaultErrorHandler(r, w, code, err)
+		}
+	})
+	defer s.Shutdown()
+
+	first := keptAliveConn(t, port)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /hello HTTP/1.1\r\n\r\n"))
+	status, headers, _ := readResponse(t, bufio.NewReader(conn))
+	if status != "HTTP/1.1 503 Service Unavailable" || headers["Connection"] != "close" {
+		t.Errorf("Expected 503 closing the connection, got %q %v", status, headers)
+	}
+	if reason := <-reasons; !errors.Is(reason, ErrTooManyConnections) {
+		t.Errorf("Expected ErrTooManyConnections reason, got %v", reason)
+	}
+
+	// Slot is freed once the first connection closes
+	first.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn := dialRetry(t, "tcp", fmt.Sprintf("localhost:%d", port))
+		conn.Write([]byte("GET /hello HTTP/1.1\r\nConnection: close\r\n\r\n"))
+		status, _, _ := readResponse(t, bufio.NewReader(conn))
+		conn.Close()
+		if status == "HTTP/1.1 200 OK" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 200 after the first connection closed, got %q", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRejectOverflow(t *testing.T) {
+	s, port := startTestServer(t, limitRouter(), func(s *Server) {
+		s.MaxConnections = 1
+		s.ConnLimit = ConnLimitReject
+	})
+	defer s.Shutdown()
+
+	first := keptAliveConn(t, port)
+	defer first.Close()
+
+	// Rejections already in progress make the server drop new ones without a response
+	s.rejecting.Store(maxRejecting)
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if n, err := conn.Read(make([]byte, 1)); n != 0 || isTimeout(err) {
+		t.Errorf("Expected dropped connection to be closed, got %d bytes, %v", n, err)
+	}
+	if n := s.rejecting.Load(); n != maxRejecting {
+		t.Errorf("Expected %d rejections in progress, got %d", maxRejecting, n)
+	}
+}
+
+func TestMaxConnectionsWait(t *testing.T) {
+	s, port := startTestServer(t, limitRouter(), func(s *Server) {
+		s.MaxConnections = 1
+	})
+	defer s.Shutdown()
+
+	first := keptAliveConn(t, port)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /hello HTTP/1.1\r\nConnection: close\r\n\r\n"))
+
+	// Second connection waits in the backlog until the first closes
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1)); !isTimeout(err) {
+		t.Fatalf("Expected second connection to wait, got %v", err)
+	}
+
+	first.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if status, _, body := readResponse(t, bufio.NewReader(conn)); status != "HTTP/1.1 200 OK" || body != "hello" {
+		t.Errorf("Expected waiting connection to be served, got %q %q", status, body)
+	}
+}
+
+func TestMaxConnectionsListeners(t *testing.T) {
+	s, port := startTestServer(t, limitRouter(), func(s *Server) {
+		s.MaxConnections = 1
+	})
+	defer s.Shutdown()
+
+	second, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(second)
+
+	// Idle listener doesn't hold the only slot
+	for _, addr := range []string{second.Addr().String(), fmt.Sprintf("localhost:%d", port)} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		conn.Write([]byte("GET /hello HTTP/1.1\r\nConnection: close\r\n\r\n"))
+		if status, _, _ := readResponse(t, bufio.NewReader(conn)); status != "HTTP/1.1 200 OK" {
+			t.Errorf("%s: expected 200, got %q", addr, status)
+		}
+		conn.Close()
+	}
+}
+
+func TestMaxConnsPerIP(t *testing.T) {
+	s, port := startTestServer(t, limitRouter(), func(s *Server) {
+		s.MaxConnsPerIP = 2
+	})
+	defer s.Shutdown()
+
+	first := keptAliveConn(t, port)
+	defer first.Close()
+	second := keptAliveConn(t, port)
+	defer second.Close()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /hello HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello"))
+	if status, _, _ := readResponse(t, bufio.NewReader(conn)); status != "HTTP/1.1 429 Too Many Requests" {
+		t.Errorf("Expected 429 over the per client limit, got %q", status)
+	}
+
+	s.mu.Lock()
+	count := s.clientConns["127.0.0.1"]
+	s.mu.Unlock()
+	if count != 2 {
+		t.Errorf("Expected 2 connections counted for the client, got %d", count)
+	}
+}
+
+// failingListener fails Accept with err, after failures errors it reports being closed
+type failingListener struct {
+	net.Listener
+	err      error
+	failures int
+	accepts  int
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.accepts++
+	if l.accepts > l.failures {
+		return nil, net.ErrClosed
+	}
+	return nil, l.err
+}
+
+func (l *failingListener) Close() error {
+	return nil
+}
+
+func (l *failingListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "failing", Net: "unix"}
+}
+
+func TestAcceptBackoff(t *testing.T) {
+	emfile := &net.OpError{Op: "accept", Err: syscall.EMFILE}
+
+	// Running out of file descriptors is retried with growing delay
+	var delays []time.Duration
+	ready := make(chan time.Time)
+	close(ready)
+	s := NewServer(":0", NewHTTPRouter())
+	s.acceptWait = func(d time.Duration) <-chan time.Time {
+		delays = append(delays, d)
+		return ready
+	}
+	l := &failingListener{err: emfile, failures: 10}
+	if err := s.Serve(l); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected closed listener error, got %v", err)
+	}
+	expected := []time.Duration{5, 10, 20, 40, 80, 160, 320, 640, 1000, 1000}
+	if len(delays) != len(expected) {
+		t.Fatalf("Expected %d delays, got %v", len(expected), delays)
+	}
+	for i, d := range expected {
+		if delays[i] != d*time.Millisecond {
+			t.Errorf("Expected delays %v ms, got %v", expected, delays)
+			break
+		}
+	}
+
+	// Shutdown interrupts the delay
+	waiting := make(chan struct{})
+	s = NewServer(":0", NewHTTPRouter())
+	s.acceptWait = func(d time.Duration) <-chan time.Time {
+		close(waiting)
+		return nil
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(&failingListener{err: emfile, failures: 1})
+	}()
+	<-waiting
+	s.Shutdown()
+	if err := <-done; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+
+	// Permanent error stops serving
+	s = NewServer(":0", NewHTTPRouter())
+	defer s.Shutdown()
+	s.acceptWait = func(d time.Duration) <-chan time.Time {
+		t.Errorf("Expected no retry of permanent error, got delay %v", d)
+		return ready
+	}
+	l = &failingListener{err: errors.New("broken listener"), failures: 1}
+	if err := s.Serve(l); err == nil || !strings.Contains(err.Error(), "broken listener") {
+		t.Errorf("Expected listener error, got %v", err)
+	}
+}
+
+func TestNextAcceptDelay(t *testing.T) {
+	var delays []time.Duration
+	delay := time.Duration(0)
+	for i := 0; i < 10; i++ {
+		delay = nextAcceptDelay(delay)
+		delays = append(delays, delay)
+	}
+	if delays[0] != minAcceptDelay || delays[1] != 2*minAcceptDelay || delays[9] != maxAcceptDelay {
+		t.Errorf("Unexpected delays %v", delays)
+	}
+}
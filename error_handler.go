@@ -0,0 +1,43 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorHandler writes the response for a request that couldn't be served
+// - code: status the response should have
+// - err: reason of the failure
+// Request is nil if it couldn't be parsed
+type ErrorHandler func(r *HTTPRequest, w ResponseWriter, code int, err error)
+
+// Failure reasons passed to error handlers by the router
+var (
+	ErrNotFound         = errors.New("no route for path")
+	ErrMethodNotAllowed = errors.New("method not allowed for path")
+)
+
+// PanicError is the reason passed to the error handler when a handler panicked
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+// Error returns the panic value as text
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v", e.Value)
+}
+
+// DefaultErrorHandler responds with the status code and its description as plain text
+func DefaultErrorHandler(r *HTTPRequest, w ResponseWriter, code int, err error) {
+	w.SetStatus(code)
+	w.Write([]byte(StatusDescription(code) + "\n"))
+}
+
+// orDefault returns h or DefaultErrorHandler if h is nil
+func (h ErrorHandler) orDefault() ErrorHandler {
+	if h == nil {
+		return DefaultErrorHandler
+	}
+	return h
+}
@@ -0,0 +1,154 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// jsonErrorHandler renders errors as JSON and records the reasons
+func jsonErrorHandler(reasons chan<- error) ErrorHandler {
+	return func(r *HTTPRequest, w ResponseWriter, code int, err error) {
+		reasons <- err
+		w.SetHeader("Content-Type", "application/json")
+		w.SetStatus(code)
+		w.Write([]byte(fmt.Sprintf(`{"error":%q}`, StatusDescription(code))))
+	}
+}
+
+func TestErrorHandlers(t *testing.T) {
+	reasons := make(chan error, 1)
+	router := NewHTTPRouter()
+	router.NotFound = jsonErrorHandler(reasons)
+	router.MethodNotAllowed = jsonErrorHandler(reasons)
+	router.HandlerFunc("GET", "/users", func(r *HTTPRequest, w ResponseWriter) {
+		w.Write([]byte("users"))
+	})
+	router.HandlerFunc("GET", "/panic", func(r *HTTPRequest, w ResponseWriter) {
+		w.SetHeader("X-Partial", "yes")
+		w.Write([]byte("partial"))
+		panic("boom")
+	})
+	router.HandlerFunc("GET", "/panic-streaming", func(r *HTTPRequest, w ResponseWriter) {
+		w.Write([]byte("partial"))
+		w.Flush()
+		panic("boom")
+	})
+
+	s, port := startTestServer(t, router, func(s *Server) {
+		s.ReadTimeout = 100 * time.Millisecond
+		s.BadRequest = jsonErrorHandler(reasons)
+		s.RequestTimeout = jsonErrorHandler(reasons)
+		s.InternalError = jsonErrorHandler(reasons)
+	})
+	defer s.Shutdown()
+
+	sendRequest := func(request string) string {
+		conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if _, err = conn.Write([]byte(request)); err != nil {
+			t.Fatalf("Failed to write to client connection: %s", err)
+		}
+
+		response, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("failed to read: %s", err)
+		}
+		return string(response)
+	}
+
+	tests := []struct {
+		name    string
+		request string
+		want    string
+		reason  func(error) bool
+	}{
+		{
+			name:    "not found",
+			request: "GET /posts HTTP/1.1\r\nConnection: close\r\n\r\n",
+			want:    "HTTP/1.1 404 Not Found\r\nConnection: close\r\nContent-Length: 21\r\nContent-Type: application/json\r\n\r\n{\"error\":\"Not Found\"}",
+			reason:  func(err error) bool { return errors.Is(err, ErrNotFound) },
+		},
+		{
+			name:    "method not allowed",
+			request: "DELETE /users HTTP/1.1\r\nConnection: close\r\n\r\n",
+			want:    "HTTP/1.1 405 Method Not Allowed\r\nAllow: GET, HEAD, OPTIONS\r\nConnection: close\r\nContent-Length: 30\r\nContent-Type: application/json\r\n\r\n{\"error\":\"Method Not Allowed\"}",
+			reason:  func(err error) bool { return errors.Is(err, ErrMethodNotAllowed) },
+		},
+		{
+			name:    "bad request",
+			request: "INVALID\r\n\r\n",
+			want:    "HTTP/1.1 400 Bad Request\r\nConnection: close\r\nContent-Length: 23\r\nContent-Type: application/json\r\n\r\n{\"error\":\"Bad Request\"}",
+			reason:  func(err error) bool { return err != nil && strings.Contains(err.Error(), "Invalid request line") },
+		},
+		{
+			name:    "unsupported transfer encoding",
+			request: "POST /users HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n",
+			want:    "HTTP/1.1 501 Not Implemented\r\nConnection: close\r\nContent-Length: 27\r\nContent-Type: application/json\r\n\r\n{\"error\":\"Not Implemented\"}",
+			reason:  func(err error) bool { return errors.Is(err, ErrUnsupportedTransferEncoding) },
+		},
+		{
+			name:    "request timeout",
+			request: "GET /users HTTP/1.1\r\n",
+			want:    "HTTP/1.1 408 Request Timeout\r\nConnection: close\r\nContent-Length: 27\r\nContent-Type: application/json\r\n\r\n{\"error\":\"Request Timeout\"}",
+			reason:  isTimeout,
+		},
+		{
+			name:    "panic drops buffered response",
+			request: "GET /panic HTTP/1.1\r\n\r\n",
+			want:    "HTTP/1.1 500 Internal Server Error\r\nConnection: close\r\nContent-Length: 33\r\nContent-Type: application/json\r\n\r\n{\"error\":\"Internal Server Error\"}",
+			reason: func(err error) bool {
+				var panicErr *PanicError
+				return errors.As(err, &panicErr) && panicErr.Value == "boom" && len(panicErr.Stack) > 0
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sendRequest(tt.request); got != tt.want {
+				t.Errorf("expected response %q, got %q", tt.want, got)
+			}
+			select {
+			case err := <-reasons:
+				if !tt.reason(err) {
+					t.Errorf("unexpected reason %v", err)
+				}
+			default:
+				t.Error("error handler wasn't called")
+			}
+		})
+	}
+
+	t.Run("panic after response was sent", func(t *testing.T) {
+		got := sendRequest("GET /panic-streaming HTTP/1.1\r\n\r\n")
+		want := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n7\r\npartial\r\n"
+		if got != want {
+			t.Errorf("expected cut off response %q, got %q", want, got)
+		}
+		select {
+		case err := <-reasons:
+			t.Errorf("error handler called for sent response: %v", err)
+		default:
+		}
+	})
+}
+
+func TestDefaultErrorHandler(t *testing.T) {
+	got := writeResponse(t, func(rw *DefaultResponseWriter) {
+		DefaultErrorHandler(nil, rw, StatusNotFound, ErrNotFound)
+		rw.Finish()
+	})
+	want := "HTTP/1.1 404 Not Found\r\nContent-Length: 10\r\nContent-Type: text/plain\r\n\r\nNot Found\n"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -30,6 +30,10 @@ func main() {
 	// Register a handler with middleware
 	router.HandlerFunc("GET", "/hello/{who}", LoggingMiddleware(HelloHandler))
 
+	// Register routes under a common prefix sharing the middleware
+	api := router.Group("/api/v1", LoggingMiddleware)
+	api.HandlerFunc("GET", "/hello/{who}", HelloHandler)
+
 	// Start the server with error handling
 	if err := server.Start(); err != nil {
 		fmt.Println("Error occurred while starting the server:", err)
@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/fmich7/http"
@@ -53,8 +55,42 @@ func main2() {
 			return
 		}
 
-		n, err := file.Write(r.Body)
-		if err != nil || n < len(r.Body) {
+		// Stream the body straight to the file
+		if _, err := io.Copy(file, r.BodyReader); err != nil {
+			w.SetStatus(http.StatusServerError)
+			w.Write([]byte(http.StatusDescription(http.StatusServerError)))
+			return
+		}
+		w.SetStatus(201)
+		w.Write([]byte("Successfully uploaded file"))
+	})
+
+	// Upload a file from a browser form (see static/index.html)
+	router.HandlerFunc("POST", "/upload", func(r *http.HTTPRequest, w http.ResponseWriter) {
+		// Keep up to 1 MB in memory, larger files go to temporary files
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			w.SetStatus(http.StatusBadRequest)
+			w.Write([]byte(http.StatusDescription(http.StatusBadRequest)))
+			return
+		}
+
+		src, header, err := r.FormFile("file")
+		if err != nil {
+			w.SetStatus(http.StatusBadRequest)
+			w.Write([]byte(http.StatusDescription(http.StatusBadRequest)))
+			return
+		}
+		defer src.Close()
+
+		dst, err := os.Create("upload/" + filepath.Base(header.Filename))
+		if err != nil {
+			w.SetStatus(http.StatusServerError)
+			w.Write([]byte(http.StatusDescription(http.StatusServerError)))
+			return
+		}
+		defer dst.Close()
+
+		if _, err := io.Copy(dst, src); err != nil {
 			w.SetStatus(http.StatusServerError)
 			w.Write([]byte(http.StatusDescription(http.StatusServerError)))
 			return
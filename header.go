@@ -0,0 +1,114 @@
+package http
+
+import (
+	"io"
+	"sort"
+	"strings"
+)
+
+// Header represents HTTP header fields
+// Keys are stored in canonical form (e.g. "Content-Type"), a field may have multiple values
+type Header map[string][]string
+
+// Get returns the first value associated with key or "" if there is none
+func (h Header) Get(key string) string {
+	if values := h[CanonicalHeaderKey(key)]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Values returns all values associated with key
+func (h Header) Values(key string) []string {
+	return h[CanonicalHeaderKey(key)]
+}
+
+// Set replaces any existing values of key with value
+func (h Header) Set(key, value string) {
+	h[CanonicalHeaderKey(key)] = []string{value}
+}
+
+// Add appends value to the values of key
+func (h Header) Add(key, value string) {
+	key = CanonicalHeaderKey(key)
+	h[key] = append(h[key], value)
+}
+
+// Del removes all values of key
+func (h Header) Del(key string) {
+	delete(h, CanonicalHeaderKey(key))
+}
+
+// clone returns a copy of h
+func (h Header) clone() Header {
+	c := make(Header, len(h))
+	for key, values := range h {
+		c[key] = append([]string(nil), values...)
+	}
+	return c
+}
+
+// has reports whether key is present
+func (h Header) has(key string) bool {
+	_, ok := h[CanonicalHeaderKey(key)]
+	return ok
+}
+
+// hasToken reports whether comma-separated values of key contain token
+func (h Header) hasToken(key, token string) bool {
+	for _, value := range h.Values(key) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newlineToSpace replaces line breaks, so a key or value can't start another header
+var newlineToSpace = strings.NewReplacer("\r", " ", "\n", " ")
+
+// write writes header lines to w, keys are sorted and each value gets its own line
+// CR and LF in keys and values are replaced with spaces
+func (h Header) write(w io.Writer) error {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, value := range h[key] {
+			line := newlineToSpace.Replace(key) + ": " + newlineToSpace.Replace(value) + CRLF
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CanonicalHeaderKey returns canonical form of header key
+// The first letter and any letter following a hyphen are upper case, the rest lower case
+// Keys containing characters other than letters, digits and hyphens are returned unchanged
+func CanonicalHeaderKey(key string) string {
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return key
+		}
+	}
+
+	b := []byte(key)
+	upper := true
+	for i, c := range b {
+		if upper && c >= 'a' && c <= 'z' {
+			b[i] = c - ('a' - 'A')
+		} else if !upper && c >= 'A' && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+		upper = c == '-'
+	}
+	return string(b)
+}
@@ -0,0 +1,87 @@
+package http
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCanonicalHeaderKey(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"content-type", "Content-Type"},
+		{"CONTENT-LENGTH", "Content-Length"},
+		{"x-forwarded-for", "X-Forwarded-For"},
+		{"Host", "Host"},
+		{"www-authenticate", "Www-Authenticate"},
+		{"invalid key", "invalid key"},
+		{"", ""},
+	}
+
+	for _, v := range tests {
+		if got := CanonicalHeaderKey(v.input); got != v.expected {
+			t.Errorf("Failed test [%s], want %s got %s\n", v.input, v.expected, got)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	h := make(Header)
+
+	h.Set("content-type", "text/html")
+	if got := h.Get("Content-Type"); got != "text/html" {
+		t.Errorf("Expected text/html, got %q", got)
+	}
+
+	h.Add("set-cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	if got := h.Values("SET-COOKIE"); len(got) != 2 || got[0] != "a=1" || got[1] != "b=2" {
+		t.Errorf("Expected both cookies, got %v", got)
+	}
+
+	h.Set("Set-Cookie", "c=3")
+	if got := h.Values("Set-Cookie"); len(got) != 1 || got[0] != "c=3" {
+		t.Errorf("Expected Set to replace values, got %v", got)
+	}
+
+	h.Del("SET-cookie")
+	if got := h.Get("Set-Cookie"); got != "" {
+		t.Errorf("Expected deleted header, got %q", got)
+	}
+
+	h.Add("Connection", "keep-alive, Upgrade")
+	if !h.hasToken("connection", "upgrade") || h.hasToken("connection", "close") {
+		t.Errorf("Unexpected tokens in %v", h.Values("Connection"))
+	}
+}
+
+func TestHeaderWrite(t *testing.T) {
+	h := make(Header)
+	h.Add("X-B", "2")
+	h.Add("x-a", "1")
+	h.Add("X-B", "3")
+
+	var buf bytes.Buffer
+	if err := h.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "X-A: 1\r\nX-B: 2\r\nX-B: 3\r\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+
+	// Line breaks can't inject another header
+	h = make(Header)
+	h.Set("X-Q", "x\r\nSet-Cookie: a=b")
+	h["X-K\nSet-Cookie"] = []string{"c=d"}
+	buf.Reset()
+	if err := h.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected = "X-K Set-Cookie: c=d\r\nX-Q: x  Set-Cookie: a=b\r\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+}
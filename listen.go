@@ -0,0 +1,190 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd
+const listenFdsStart = 3
+
+// listen opens listener for addr, listener handed over by the parent process is used first
+// - "unix:/path.sock" listens on Unix socket, stale socket file is replaced
+// - "systemd:" adopts the first socket passed by systemd, "systemd:name" the one named by FileDescriptorName
+// - anything else is a TCP address
+func (s *Server) listen(addr string) (net.Listener, error) {
+	listener := inheritedListener(addr)
+	if listener == nil {
+		var err error
+		if listener, err = openListener(addr, s.UnixSocketMode); err != nil {
+			return nil, err
+		}
+	}
+
+	s.trackHandoff(addr, listener)
+	return listener, nil
+}
+
+// openListener opens new listener for addr as described by listen
+func openListener(addr string, mode fs.FileMode) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, "unix:"):
+		return listenUnix(strings.TrimPrefix(addr, "unix:"), mode)
+	case strings.HasPrefix(addr, "systemd:"):
+		return systemdListener(strings.TrimPrefix(addr, "systemd:"))
+	}
+	return net.Listen("tcp", addr)
+}
+
+// listenUnix listens on Unix socket at path with mode permissions
+// Socket file left by a process that is gone is removed first,
+// socket still accepting connections is an error
+func listenUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("empty unix socket path")
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+		}
+	}
+	return listener, nil
+}
+
+// removeStaleSocket removes socket file at path if nobody listens on it
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and isn't a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is already in use", path)
+	}
+	return os.Remove(path)
+}
+
+// activated holds sockets passed by systemd, they're adopted once per process
+var activated struct {
+	once      sync.Once
+	listeners []net.Listener
+	names     []string
+	taken     []bool
+	err       error
+	mu        sync.Mutex
+}
+
+// SystemdListeners returns listeners for sockets passed by systemd socket activation
+// Sockets are taken from LISTEN_FDS if LISTEN_PID is the current process, the variables
+// are unset so child processes don't adopt them again
+// Without socket activation the result is empty
+func SystemdListeners() ([]net.Listener, error) {
+	adoptSystemdSockets()
+	return activated.listeners, activated.err
+}
+
+// systemdListener returns socket passed by systemd with name, the first one for empty name
+// Every socket can be taken only once
+func systemdListener(name string) (net.Listener, error) {
+	adoptSystemdSockets()
+	if activated.err != nil {
+		return nil, activated.err
+	}
+
+	activated.mu.Lock()
+	defer activated.mu.Unlock()
+	for i, l := range activated.listeners {
+		if activated.taken[i] || (name != "" && activated.names[i] != name) {
+			continue
+		}
+		activated.taken[i] = true
+		return l, nil
+	}
+	if name == "" {
+		return nil, errors.New("no socket passed by systemd")
+	}
+	return nil, fmt.Errorf("no socket named %q passed by systemd", name)
+}
+
+// adoptSystemdSockets turns sockets passed by systemd into listeners on the first call
+func adoptSystemdSockets() {
+	activated.once.Do(func() {
+		count, names, err := listenFds(os.Getpid(), os.Getenv)
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+		if err != nil {
+			activated.err = err
+			return
+		}
+
+		for i := 0; i < count; i++ {
+			file := os.NewFile(uintptr(listenFdsStart+i), names[i])
+			l, err := net.FileListener(file)
+			file.Close()
+			if err != nil {
+				activated.err = fmt.Errorf("socket %d passed by systemd: %w", listenFdsStart+i, err)
+				return
+			}
+			activated.listeners = append(activated.listeners, l)
+		}
+		activated.names = names
+		activated.taken = make([]bool, count)
+	})
+}
+
+// listenFds returns number and names of sockets passed to process pid
+// as described by sd_listen_fds(3), getenv reads the environment
+func listenFds(pid int, getenv func(string) string) (int, []string, error) {
+	pidValue := getenv("LISTEN_PID")
+	if pidValue == "" {
+		return 0, nil, nil
+	}
+	listenPid, err := strconv.Atoi(pidValue)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid LISTEN_PID %q", pidValue)
+	}
+	// Variables were meant for another process
+	if listenPid != pid {
+		return 0, nil, nil
+	}
+
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 0 {
+		return 0, nil, fmt.Errorf("invalid LISTEN_FDS %q", getenv("LISTEN_FDS"))
+	}
+
+	names := make([]string, count)
+	if value := getenv("LISTEN_FDNAMES"); value != "" {
+		given := strings.Split(value, ":")
+		if len(given) != count {
+			return 0, nil, fmt.Errorf("LISTEN_FDNAMES has %d names for %d sockets", len(given), count)
+		}
+		copy(names, given)
+	}
+	return count, names, nil
+}
@@ -0,0 +1,217 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// dialRetry dials addr until it accepts connections
+func dialRetry(t *testing.T, network, addr string) net.Conn {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial(network, addr)
+		if err == nil {
+			return conn
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Failed to connect to %s: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are tested on unix systems")
+	}
+	path := filepath.Join(t.TempDir(), "http.sock")
+
+	router := NewHTTPRouter()
+	router.HandlerFunc("GET", "/ok", func(r *HTTPRequest, w ResponseWriter) {
+		w.Write([]byte("ok"))
+	})
+	s := NewServer("unix:"+path, router)
+	s.UnixSocketMode = 0o600
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ListenAndServe(ctx)
+	}()
+
+	conn := dialRetry(t, "unix", path)
+	conn.Write([]byte("GET /ok HTTP/1.1\r\nConnection: close\r\n\r\n"))
+	status, _, body := readResponse(t, bufio.NewReader(conn))
+	conn.Close()
+	if status != "HTTP/1.1 200 OK" || body != "ok" {
+		t.Errorf("Unexpected response %q %q", status, body)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected socket mode 0600, got %v", info.Mode().Perm())
+	}
+
+	// Second server can't take over a socket in use
+	if _, err := listenUnix(path, 0); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("Expected socket in use error, got %v", err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected clean shutdown, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected socket file to be removed, got %v", err)
+	}
+}
+
+func TestListenUnixStale(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are tested on unix systems")
+	}
+	dir := t.TempDir()
+
+	// Socket file left behind by a crashed process
+	path := filepath.Join(dir, "stale.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	l, err = listenUnix(path, 0)
+	if err != nil {
+		t.Fatalf("Expected stale socket to be replaced, got %v", err)
+	}
+	l.Close()
+
+	regular := filepath.Join(dir, "regular")
+	if err := os.WriteFile(regular, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenUnix(regular, 0); err == nil {
+		t.Error("Expected error for a regular file")
+	}
+	if _, err := os.Stat(regular); err != nil {
+		t.Errorf("Expected regular file to stay, got %v", err)
+	}
+
+	if _, err := listenUnix("", 0); err == nil {
+		t.Error("Expected error for empty path")
+	}
+}
+
+func TestListenFds(t *testing.T) {
+	tests := []struct {
+		name  string
+		env   map[string]string
+		count int
+		names []string
+		err   bool
+	}{
+		{"no activation", map[string]string{}, 0, nil, false},
+		{"other process", map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "2"}, 0, nil, false},
+		{"sockets", map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "2"}, 2, []string{"", ""}, false},
+		{"named sockets", map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "2", "LISTEN_FDNAMES": "web:admin"}, 2, []string{"web", "admin"}, false},
+		{"invalid pid", map[string]string{"LISTEN_PID": "abc", "LISTEN_FDS": "1"}, 0, nil, true},
+		{"invalid count", map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "-1"}, 0, nil, true},
+		{"missing count", map[string]string{"LISTEN_PID": "42"}, 0, nil, true},
+		{"names mismatch", map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "2", "LISTEN_FDNAMES": "web"}, 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		count, names, err := listenFds(42, func(key string) string { return tt.env[key] })
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if count != tt.count || strings.Join(names, ",") != strings.Join(tt.names, ",") || len(names) != len(tt.names) {
+			t.Errorf("%s: expected %d %q, got %d %q", tt.name, tt.count, tt.names, count, names)
+		}
+	}
+}
+
+// TestSystemdHelperProcess is the child process of TestSystemdActivation
+// It serves on the socket passed like systemd does
+func TestSystemdHelperProcess(t *testing.T) {
+	if os.Getenv("HTTP_TEST_SYSTEMD_CHILD") != "1" {
+		t.Skip("helper process")
+	}
+
+	router := NewHTTPRouter()
+	router.HandlerFunc("GET", "/pid", func(r *HTTPRequest, w ResponseWriter) {
+		w.Write([]byte(fmt.Sprintf("%d %q", os.Getpid(), os.Getenv("LISTEN_FDS"))))
+	})
+	s := NewServer("systemd:web", router)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSystemdActivation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket activation is tested on unix systems")
+	}
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("needs /bin/sh")
+	}
+
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Shell sets LISTEN_PID to its own pid and execs the test binary keeping it
+	cmd := exec.Command("/bin/sh", "-c", `LISTEN_PID=$$ LISTEN_FDS=1 LISTEN_FDNAMES=web exec "$0" "$@"`,
+		os.Args[0], "-test.run=^TestSystemdHelperProcess$")
+	cmd.Env = append(os.Environ(), "HTTP_TEST_SYSTEMD_CHILD=1")
+	cmd.ExtraFiles = []*os.File{file}
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	// Child owns the socket now
+	addr := l.Addr().String()
+	file.Close()
+	l.Close()
+
+	conn := dialRetry(t, "tcp", addr)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	conn.Write([]byte("GET /pid HTTP/1.1\r\nConnection: close\r\n\r\n"))
+	status, _, body := readResponse(t, bufio.NewReader(conn))
+	conn.Close()
+
+	expected := strconv.Itoa(cmd.Process.Pid) + ` ""`
+	if status != "HTTP/1.1 200 OK" || body != expected {
+		t.Errorf("Expected response %q from the child, got %q %q", expected, status, body)
+	}
+
+	cmd.Process.Signal(syscall.SIGTERM)
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("Child didn't exit cleanly: %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+package http
+
+// Middleware wraps a handler with additional behaviour
+// It can run code before and after calling the next handler or not call it at all
+type Middleware func(HTTPHandler) HTTPHandler
+
+// Chain composes middleware into one, the first middleware is the outermost
+// Chain(a, b, c)(h) runs like a(b(c(h)))
+func Chain(middleware ...Middleware) Middleware {
+	return func(h HTTPHandler) HTTPHandler {
+		for i := len(middleware) - 1; i >= 0; i-- {
+			h = middleware[i](h)
+		}
+		return h
+	}
+}
@@ -0,0 +1,51 @@
+package http
+
+import (
+	"strings"
+	"testing"
+)
+
+// orderMiddleware records tag before and after calling the next handler
+func orderMiddleware(trace *[]string, tag string) Middleware {
+	return func(next HTTPHandler) HTTPHandler {
+		return func(r *HTTPRequest, w ResponseWriter) {
+			*trace = append(*trace, tag)
+			next(r, w)
+			*trace = append(*trace, "/"+tag)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	var trace []string
+	handler := func(r *HTTPRequest, w ResponseWriter) {
+		trace = append(trace, "handler")
+	}
+
+	tests := []struct {
+		name       string
+		middleware []Middleware
+		expected   string
+	}{
+		{"empty chain", nil, "handler"},
+		{"single", []Middleware{orderMiddleware(&trace, "a")}, "a handler /a"},
+		{
+			"first is outermost",
+			[]Middleware{orderMiddleware(&trace, "a"), orderMiddleware(&trace, "b"), orderMiddleware(&trace, "c")},
+			"a b c handler /c /b /a",
+		},
+		{
+			"nested chains",
+			[]Middleware{Chain(orderMiddleware(&trace, "a"), orderMiddleware(&trace, "b")), orderMiddleware(&trace, "c")},
+			"a b c handler /c /b /a",
+		},
+	}
+
+	for _, tt := range tests {
+		trace = nil
+		Chain(tt.middleware...)(handler)(&HTTPRequest{}, nil)
+		if got := strings.Join(trace, " "); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
@@ -1,12 +1,18 @@
 package http
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,25 +24,75 @@ type HTTPRequest struct {
 	// Method of the request
 	Method string
 
-	// Target path of the request (e.g. "/api/something")
+	// Target of the request as sent by the client (e.g. "/api/something?page=2")
 	URL string
 
+	// Path is the percent-decoded path of URL without the query string (e.g. "/api/something")
+	Path string
+
+	// RawQuery is the encoded query string of URL without "?" (e.g. "page=2")
+	RawQuery string
+
 	// HTTP version of the request
 	ProtocolVersion string
 
-	// Key-value pairs of HTTP headers included in the request
-	Headers map[string]string
+	// HTTP headers included in the request
+	Headers Header
 
 	// Body holds the raw content of the request body
+	// It's only filled by ParseRequest or handlers wrapped with BufferBody
 	Body []byte
 
+	// BodyReader streams the request body directly from the connection
+	BodyReader io.ReadCloser
+
+	// Trailers holds trailer fields sent after a chunked body
+	// They are available once BodyReader has been read to EOF
+	Trailers Header
+
 	// Params stores any route parameters extracted from the URL (e.g. "/users/{id}", gives {"id": "123"})
 	Params map[string]string
 
+	// Form holds query values and urlencoded or multipart body fields, filled by ParseForm
+	Form url.Values
+
+	// PostForm holds only body form fields, filled by ParseForm
+	PostForm url.Values
+
+	// MultipartForm holds parsed multipart body with uploaded files, filled by ParseMultipartForm
+	MultipartForm *multipart.Form
+
+	// TLS holds state of the TLS connection the request came on, nil for plain connections
+	TLS *tls.ConnectionState
+
+	// cleanups run after the request is served, shared by copies of the request
+	cleanups *[]func()
+
 	// Context for the request, which can carry deadlines
 	ctx context.Context
 }
 
+// Query parses RawQuery and returns decoded values
+// Malformed pairs are skipped
+func (r *HTTPRequest) Query() url.Values {
+	values, _ := url.ParseQuery(r.RawQuery)
+	return values
+}
+
+// rawPath returns URL without the query string, still encoded
+func (r *HTTPRequest) rawPath() string {
+	path, _, _ := strings.Cut(r.URL, "?")
+	return path
+}
+
+// afterServe registers f to run after the server finished the request
+// Requests not read by the server never run f
+func (r *HTTPRequest) afterServe(f func()) {
+	if r.cleanups != nil {
+		*r.cleanups = append(*r.cleanups, f)
+	}
+}
+
 // Context return's the request context
 func (r *HTTPRequest) Context() context.Context {
 	if r.ctx != nil {
@@ -56,19 +112,46 @@ func (r *HTTPRequest) WithContext(ctx context.Context) *HTTPRequest {
 	return n
 }
 
+// Errors returned while reading the request body
+var (
+	ErrInvalidContentLength = errors.New("invalid Content-Length")
+	ErrBodyLengthMismatch   = errors.New("body length does not match Content-Length")
+)
+
+// maxHeaderBytes limits size of the request line and headers
+const maxHeaderBytes = 1 << 20
+
 // ReadRequest reads request data bytes to buffer
+// Reading stops after the header terminator, anything read past it is dropped
+// Server reads requests from a per connection reader, so pipelined requests aren't lost
 func ReadRequest(conn net.Conn, readTimeout time.Duration) ([]byte, error) {
 	// Set the read deadline
 	conn.SetReadDeadline(time.Now().Add(readTimeout))
 	defer conn.SetReadDeadline(time.Time{})
 
-	// Read request
+	return readHead(bufio.NewReader(conn))
+}
+
+// readHead reads from r up to the header terminator or EOF
+// Empty lines before the request line are skipped (RFC 7230 3.5)
+func readHead(r *bufio.Reader) ([]byte, error) {
 	var buf bytes.Buffer
-	tmp := make([]byte, 1024)
 	for {
-		n, err := conn.Read(tmp)
+		line, err := r.ReadSlice('\n')
+		if buf.Len() == 0 && err == nil && string(line) == CRLF {
+			continue
+		}
+		buf.Write(line)
+		if buf.Len() > maxHeaderBytes {
+			return nil, errors.New("Request header too large")
+		}
+
 		if err != nil {
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			// Line longer than reader's buffer, keep reading it
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if isTimeout(err) {
 				return nil, fmt.Errorf("read timeout occurred: %w", err)
 			}
 
@@ -77,9 +160,7 @@ func ReadRequest(conn net.Conn, readTimeout time.Duration) ([]byte, error) {
 			}
 			return nil, fmt.Errorf("read error: %w", err)
 		}
-		buf.Write(tmp[:n])
-		// TODO: Improve this part
-		if bytes.Contains(buf.Bytes(), []byte("\r\n\r\n")) {
+		if bytes.HasSuffix(buf.Bytes(), []byte("\r\n\r\n")) {
 			break
 		}
 	}
@@ -88,15 +169,41 @@ func ReadRequest(conn net.Conn, readTimeout time.Duration) ([]byte, error) {
 }
 
 // ParseRequest gets infromations from incoming request
+// The whole request has to arrive within readTimeout and its body is buffered in Body
 func ParseRequest(conn net.Conn, readTimeout time.Duration) (*HTTPRequest, error) {
+	// Set the read deadline for head and body
+	conn.SetReadDeadline(time.Now().Add(readTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	req, err := readRequest(bufio.NewReader(conn))
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Body, err = io.ReadAll(req.BodyReader); err != nil {
+		return nil, err
+	}
+	req.BodyReader = io.NopCloser(bytes.NewReader(req.Body))
+
+	return req, nil
+}
+
+// readRequest parses request head from r, the body is left on r
+// and streamed through BodyReader
+// io.EOF is returned if r ends before any request data
+func readRequest(r *bufio.Reader) (*HTTPRequest, error) {
 	// Read data from connection
-	reqData, err := ReadRequest(conn, readTimeout)
+	reqData, err := readHead(r)
 	if err != nil {
 		return nil, err
 	}
+	if len(reqData) == 0 {
+		return nil, io.EOF
+	}
 
 	// Split data and read method url protocol
-	splitData := bytes.Split(reqData, []byte("\r\n"))
+	head := bytes.TrimRight(reqData, CRLF)
+	splitData := bytes.Split(head, []byte(CRLF))
 	reqLineVals := bytes.Split(splitData[0], []byte(" "))
 	if len(reqLineVals) != 3 {
 		return nil, errors.New("Invalid request line")
@@ -104,39 +211,109 @@ func ParseRequest(conn net.Conn, readTimeout time.Duration) (*HTTPRequest, error
 
 	// Request attributes
 	method := reqLineVals[0]
-	url := reqLineVals[1]
+	target := string(reqLineVals[1])
 	protocol := reqLineVals[2]
-	headers := make(map[string]string)
-	body := make([]byte, 0)
+	headers := make(Header)
 	// Get header values
-	i := 1
-	for i < len(splitData) {
-		if len(splitData[i]) == 0 {
-			i++
-			break
+	for _, line := range splitData[1:] {
+		key, value, err := parseHeaderLine(line)
+		if err != nil {
+			return nil, err
 		}
+		headers.Add(key, value)
+	}
+
+	req := &HTTPRequest{
+		Method:          string(method),
+		URL:             target,
+		ProtocolVersion: string(protocol),
+		Headers:         headers,
+	}
+
+	// Control characters in the target would end up in headers like Location
+	if strings.IndexFunc(target, isControl) >= 0 {
+		return nil, fmt.Errorf("Invalid request target %q", target)
+	}
 
-		headerLineValues := bytes.Split(splitData[i], []byte(": "))
-		if len(headerLineValues) != 2 {
-			return nil, errors.New("Invalid header entry")
+	// Split target into decoded path and query string
+	rawPath, rawQuery, _ := strings.Cut(target, "?")
+	if req.Path, err = url.PathUnescape(rawPath); err != nil {
+		return nil, fmt.Errorf("Invalid request path: %w", err)
+	}
+	req.RawQuery = rawQuery
+
+	// Body is framed either by chunked encoding or by Content-Length
+	if headers.has("Transfer-Encoding") {
+		te := strings.Join(headers.Values("Transfer-Encoding"), ",")
+		if !isChunked(te) {
+			return nil, fmt.Errorf("%w: %q", ErrUnsupportedTransferEncoding, te)
+		}
+		// Both framings at once is a request smuggling attempt
+		if headers.has("Content-Length") {
+			return nil, errors.New("Both Transfer-Encoding and Content-Length set")
 		}
 
-		headers[string(headerLineValues[0])] = string(headerLineValues[1])
-		i++
+		cr := newChunkedReader(r)
+		req.Trailers = cr.trailer
+		req.BodyReader = &body{src: cr}
+		return req, nil
 	}
 
-	// Copy data to body if there is any
-	if i < len(splitData) {
-		body = splitData[i]
+	length, err := contentLength(headers)
+	if err != nil {
+		return nil, err
 	}
+	req.BodyReader = &body{src: &lengthReader{r: r, n: length}}
 
-	return &HTTPRequest{
-		Method:          string(method),
-		URL:             string(url),
-		ProtocolVersion: string(protocol),
-		Headers:         headers,
-		Body:            body,
-	}, nil
+	return req, nil
+}
+
+// parseHeaderLine splits "Key: Value" header line
+// Whitespace around the value is trimmed, key can't contain any
+func parseHeaderLine(line []byte) (string, string, error) {
+	key, value, found := bytes.Cut(line, []byte(":"))
+	if !found || len(key) == 0 || bytes.ContainsAny(key, " \t") {
+		return "", "", errors.New("Invalid header entry")
+	}
+
+	return string(key), string(bytes.TrimSpace(value)), nil
+}
+
+// contentLength returns the body length declared in headers
+// Requests without Content-Length have no body, repeated values have to be equal
+func contentLength(headers Header) (int64, error) {
+	values := headers.Values("Content-Length")
+	if len(values) == 0 {
+		return 0, nil
+	}
+	value := strings.TrimSpace(values[0])
+	for _, v := range values[1:] {
+		if strings.TrimSpace(v) != value {
+			return 0, fmt.Errorf("%w: conflicting values %q", ErrInvalidContentLength, values)
+		}
+	}
+
+	// Only plain digits are allowed, so signs are rejected too
+	if value == "" || strings.TrimLeft(value, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidContentLength, value)
+	}
+	length, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidContentLength, value)
+	}
+
+	return length, nil
+}
+
+// isControl reports whether r is an ASCII control character
+func isControl(r rune) bool {
+	return r < ' ' || r == 0x7f
+}
+
+// isTimeout reports whether err is a network timeout
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
 // func (r HTTPRequest) String() string {
@@ -167,9 +344,15 @@ func isEqualHTTPRequest(a, b HTTPRequest) bool {
 	}
 
 	for k, v := range a.Headers {
-		if vb, ok := b.Headers[k]; !ok || vb != v {
+		vb, ok := b.Headers[k]
+		if !ok || len(vb) != len(v) {
 			return false
 		}
+		for i := range v {
+			if vb[i] != v[i] {
+				return false
+			}
+		}
 	}
 
 	if !bytes.Equal(a.Body, b.Body) {
@@ -0,0 +1,120 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+// ErrBodyClosed is returned when reading request body after Close
+var ErrBodyClosed = errors.New("read on closed body")
+
+// body streams request body from the connection
+type body struct {
+	src    io.Reader
+	closed bool
+
+	// conn gets read deadline timeout from now before every read, if set
+	conn    net.Conn
+	timeout time.Duration
+}
+
+// Read reads body bytes, read timeouts are reported as "read timeout"
+// Every read waits up to timeout, so a body that keeps arriving never times out
+func (b *body) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, ErrBodyClosed
+	}
+
+	b.extendDeadline()
+	n, err := b.src.Read(p)
+	if err != nil && isTimeout(err) {
+		err = fmt.Errorf("read timeout occurred: %w", err)
+	}
+	return n, err
+}
+
+// Close stops further reads of the body
+func (b *body) Close() error {
+	b.closed = true
+	return nil
+}
+
+// extendDeadline gives the next read of the connection another timeout
+func (b *body) extendDeadline() {
+	if b.conn != nil {
+		b.conn.SetReadDeadline(time.Now().Add(b.timeout))
+	}
+}
+
+// discard reads and drops the rest of the body, so the next request
+// on the connection can be read. Bodies longer than limit aren't drained
+func (b *body) discard(limit int64) error {
+	b.extendDeadline()
+	_, err := io.CopyN(io.Discard, b.src, limit+1)
+	if err == io.EOF {
+		return nil
+	}
+	if err == nil {
+		return fmt.Errorf("unread body exceeds %d bytes", limit)
+	}
+	return err
+}
+
+// lengthReader reads body framed by Content-Length
+type lengthReader struct {
+	r io.Reader
+	n int64 // bytes left to read
+}
+
+// Read reads up to remaining body bytes, connection closed
+// before all of them arrived is reported as ErrBodyLengthMismatch
+func (lr *lengthReader) Read(p []byte) (int, error) {
+	if lr.n <= 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > lr.n {
+		p = p[:lr.n]
+	}
+	n, err := lr.r.Read(p)
+	lr.n -= int64(n)
+	if err == io.EOF && lr.n > 0 {
+		err = fmt.Errorf("%w: %d bytes missing", ErrBodyLengthMismatch, lr.n)
+	}
+	return n, err
+}
+
+// BufferBody wraps a HTTPHandler and reads the whole request body
+// into HTTPRequest.Body before calling it
+// Bodies larger than maxSize are rejected with 413 Content Too Large
+func BufferBody(org HTTPHandler, maxSize int64) HTTPHandler {
+	return func(r *HTTPRequest, w ResponseWriter) {
+		data, err := io.ReadAll(io.LimitReader(r.BodyReader, maxSize+1))
+		if err != nil {
+			code := StatusBadRequest
+			if isTimeout(err) {
+				code = StatusRequestTimeout
+			}
+			log.Printf("Failed to read body of request to %s: %v", r.URL, err)
+			w.SetStatus(code)
+			w.Write([]byte(StatusDescription(code)))
+			return
+		}
+
+		if int64(len(data)) > maxSize {
+			log.Printf("Body of request to %s exceeds %d bytes", r.URL, maxSize)
+			w.SetStatus(StatusContentTooLarge)
+			w.Write([]byte(StatusDescription(StatusContentTooLarge)))
+			return
+		}
+
+		r.Body = data
+		r.BodyReader = io.NopCloser(bytes.NewReader(data))
+		org(r, w)
+	}
+}
@@ -0,0 +1,167 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadRequestStreamsBody(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	head := "POST /upload HTTP/1.1\r\nContent-Length: 10\r\n\r\n"
+	go client.Write([]byte(head))
+
+	// Head is parsed before any body bytes were sent
+	req, err := readRequest(bufio.NewReader(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		client.Write([]byte("hello"))
+		client.Write([]byte("world"))
+	}()
+
+	got, err := io.ReadAll(req.BodyReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "helloworld" {
+		t.Errorf("Expected body %q, got %q", "helloworld", got)
+	}
+
+	req.BodyReader.Close()
+	if _, err := req.BodyReader.Read(make([]byte, 1)); !errors.Is(err, ErrBodyClosed) {
+		t.Errorf("Expected %v after Close, got %v", ErrBodyClosed, err)
+	}
+}
+
+func TestSlowBody(t *testing.T) {
+	router := NewHTTPRouter()
+	router.HandlerFunc("POST", "/upload", func(r *HTTPRequest, w ResponseWriter) {
+		n, err := io.Copy(io.Discard, r.BodyReader)
+		if err != nil {
+			w.SetStatus(StatusRequestTimeout)
+		}
+		w.Write([]byte(fmt.Sprintf("%d", n)))
+	})
+
+	s, port := startTestServer(t, router, func(s *Server) {
+		s.ReadTimeout = 300 * time.Millisecond
+	})
+	defer s.Shutdown()
+
+	// upload sends "ab" after every pause
+	upload := func(t *testing.T, pauses ...time.Duration) string {
+		conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		fmt.Fprintf(conn, "POST /upload HTTP/1.1\r\nContent-Length: %d\r\nConnection: close\r\n\r\n", 2*len(pauses))
+		for _, pause := range pauses {
+			time.Sleep(pause)
+			conn.Write([]byte("ab"))
+		}
+		_, _, body := readResponse(t, bufio.NewReader(conn))
+		return body
+	}
+
+	// Body arriving for longer than ReadTimeout in total is read whole
+	t.Run("steady", func(t *testing.T) {
+		pause := 100 * time.Millisecond
+		if body := upload(t, pause, pause, pause, pause, pause); body != "10" {
+			t.Errorf("Expected whole body to be read, got %q", body)
+		}
+	})
+
+	// Body stalled for longer than ReadTimeout times out
+	t.Run("stalled", func(t *testing.T) {
+		if body := upload(t, 600*time.Millisecond); body != "0" {
+			t.Errorf("Expected read timeout, got %q", body)
+		}
+	})
+}
+
+func TestBufferBody(t *testing.T) {
+	router := NewHTTPRouter()
+	echo := func(r *HTTPRequest, w ResponseWriter) {
+		w.Write(r.Body)
+	}
+	router.HandlerFunc("POST", "/buffered", BufferBody(echo, 8))
+	router.HandlerFunc("POST", "/stream", func(r *HTTPRequest, w ResponseWriter) {
+		n, err := io.Copy(io.Discard, r.BodyReader)
+		if err != nil {
+			w.SetStatus(StatusBadRequest)
+		}
+		w.Write([]byte(fmt.Sprintf("%d", n)))
+	})
+
+	s, port := startTestServer(t, router)
+	defer s.Shutdown()
+
+	sendRequest := func(request string) string {
+		conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if _, err = conn.Write([]byte(request)); err != nil {
+			t.Fatalf("Failed to write to client connection: %s", err)
+		}
+
+		response, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("failed to read: %s", err)
+		}
+		return string(response)
+	}
+
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{
+			name:    "buffered body",
+			request: "POST /buffered HTTP/1.1\r\nConnection: close\r\nContent-Length: 5\r\n\r\nhello",
+			want:    "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\nhello",
+		},
+		{
+			name:    "buffered chunked body",
+			request: "POST /buffered HTTP/1.1\r\nConnection: close\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nhe\r\n3\r\nllo\r\n0\r\n\r\n",
+			want:    "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 5\r\nContent-Type: text/plain\r\n\r\nhello",
+		},
+		{
+			name:    "body too large",
+			request: "POST /buffered HTTP/1.1\r\nConnection: close\r\nContent-Length: 9\r\n\r\n123456789",
+			want:    "HTTP/1.1 413 Content Too Large\r\nConnection: close\r\nContent-Length: 17\r\nContent-Type: text/plain\r\n\r\nContent Too Large",
+		},
+		{
+			name:    "malformed chunk",
+			request: "POST /buffered HTTP/1.1\r\nConnection: close\r\nTransfer-Encoding: chunked\r\n\r\nxyz\r\n",
+			want:    "HTTP/1.1 400 Bad Request\r\nConnection: close\r\nContent-Length: 11\r\nContent-Type: text/plain\r\n\r\nBad Request",
+		},
+		{
+			name:    "streamed body",
+			request: "POST /stream HTTP/1.1\r\nConnection: close\r\nContent-Length: 4096\r\n\r\n" + strings.Repeat("x", 4096),
+			want:    "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 4\r\nContent-Type: text/plain\r\n\r\n4096",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := sendRequest(tt.request); got != tt.want {
+			t.Errorf("%s: expected response %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
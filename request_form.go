@@ -0,0 +1,140 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+)
+
+// maxFormSize limits size of application/x-www-form-urlencoded bodies
+const maxFormSize = 10 << 20
+
+// defaultMaxMemory is used when form is parsed implicitly by FormValue and FormFile
+const defaultMaxMemory = 32 << 20
+
+// Errors returned while parsing forms
+var (
+	ErrNotMultipart    = errors.New("request Content-Type isn't multipart/form-data")
+	ErrMissingFile     = errors.New("no such file in multipart form")
+	ErrFormTooLarge    = errors.New("form body too large")
+	ErrMissingBoundary = errors.New("no multipart boundary in Content-Type")
+)
+
+// ParseForm fills Form with query values and, for urlencoded bodies, PostForm with body fields
+// Body fields are placed before query values in Form, calling it again does nothing
+func (r *HTTPRequest) ParseForm() error {
+	if r.Form != nil {
+		return nil
+	}
+
+	var err error
+	if r.PostForm == nil {
+		r.PostForm, err = r.parsePostForm()
+		if r.PostForm == nil {
+			r.PostForm = make(url.Values)
+		}
+	}
+
+	r.Form = make(url.Values)
+	for key, values := range r.PostForm {
+		r.Form[key] = append(r.Form[key], values...)
+	}
+	query, queryErr := url.ParseQuery(r.RawQuery)
+	for key, values := range query {
+		r.Form[key] = append(r.Form[key], values...)
+	}
+
+	if err == nil {
+		err = queryErr
+	}
+	return err
+}
+
+// parsePostForm reads urlencoded body, other content types give no values
+func (r *HTTPRequest) parsePostForm() (url.Values, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Headers.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" || r.BodyReader == nil {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.BodyReader, maxFormSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFormSize {
+		return nil, ErrFormTooLarge
+	}
+
+	return url.ParseQuery(string(data))
+}
+
+// ParseMultipartForm parses multipart/form-data body into MultipartForm
+// Up to maxMemory bytes of file parts are kept in memory, the rest is stored in temporary files
+// Field values are also added to Form and PostForm
+func (r *HTTPRequest) ParseMultipartForm(maxMemory int64) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	if r.MultipartForm != nil {
+		return nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(r.Headers.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return ErrNotMultipart
+	}
+	boundary, ok := params["boundary"]
+	if !ok {
+		return ErrMissingBoundary
+	}
+
+	form, err := multipart.NewReader(r.BodyReader, boundary).ReadForm(maxMemory)
+	if err != nil {
+		return fmt.Errorf("failed to read multipart form: %w", err)
+	}
+	r.MultipartForm = form
+
+	// Temporary files are removed after the request is served
+	r.afterServe(func() {
+		form.RemoveAll()
+	})
+
+	for key, values := range form.Value {
+		r.Form[key] = append(r.Form[key], values...)
+		r.PostForm[key] = append(r.PostForm[key], values...)
+	}
+	return nil
+}
+
+// FormValue returns the first value for key from Form
+// Form is parsed on first use, parse errors are ignored
+func (r *HTTPRequest) FormValue(key string) string {
+	if r.Form == nil {
+		r.ParseMultipartForm(defaultMaxMemory)
+	}
+	return r.Form.Get(key)
+}
+
+// FormFile returns the first uploaded file for key
+// Multipart form is parsed on first use
+func (r *HTTPRequest) FormFile(key string) (multipart.File, *multipart.FileHeader, error) {
+	if r.MultipartForm == nil {
+		if err := r.ParseMultipartForm(defaultMaxMemory); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	files := r.MultipartForm.File[key]
+	if len(files) == 0 {
+		return nil, nil, ErrMissingFile
+	}
+
+	file, err := files[0].Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, files[0], nil
+}
@@ -0,0 +1,172 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+// multipartBody builds multipart/form-data body with a single field and file
+func multipartBody(t *testing.T, field, file string, content []byte) (string, *bytes.Buffer) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := mw.WriteField(field, "value"); err != nil {
+		t.Fatal(err)
+	}
+	fw, err := mw.CreateFormFile(file, "upload.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(content)
+	mw.Close()
+
+	return mw.FormDataContentType(), &buf
+}
+
+func TestParseForm(t *testing.T) {
+	body := "name=J%C3%B3zef&tag=body"
+	input := fmt.Sprintf("POST /form?tag=query&page=2 HTTP/1.1\r\nContent-Type: application/x-www-form-urlencoded\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+	req, err := readRequest(bufio.NewReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := req.ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+
+	if req.FormValue("name") != "Józef" || req.FormValue("page") != "2" {
+		t.Errorf("Unexpected form values %v", req.Form)
+	}
+	// Body values come before query values
+	if tags := req.Form["tag"]; len(tags) != 2 || tags[0] != "body" || tags[1] != "query" {
+		t.Errorf("Expected tags [body query], got %v", tags)
+	}
+	if req.PostForm.Get("page") != "" || req.PostForm.Get("name") != "Józef" {
+		t.Errorf("Unexpected post form values %v", req.PostForm)
+	}
+
+	t.Run("other content type leaves body", func(t *testing.T) {
+		input := "POST /form?a=1 HTTP/1.1\r\nContent-Type: application/json\r\nContent-Length: 2\r\n\r\n{}"
+		req, err := readRequest(bufio.NewReader(strings.NewReader(input)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := req.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if len(req.PostForm) != 0 || req.Form.Get("a") != "1" {
+			t.Errorf("Unexpected form values %v %v", req.Form, req.PostForm)
+		}
+		if data, _ := io.ReadAll(req.BodyReader); string(data) != "{}" {
+			t.Errorf("Expected body to stay unread, got %q", data)
+		}
+	})
+}
+
+func TestParseMultipartForm(t *testing.T) {
+	content := bytes.Repeat([]byte("x"), 2048)
+	contentType, body := multipartBody(t, "title", "file", content)
+	input := fmt.Sprintf("POST /upload HTTP/1.1\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s", contentType, body.Len(), body)
+
+	req, err := readRequest(bufio.NewReader(strings.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := req.ParseMultipartForm(1024); err != nil {
+		t.Fatal(err)
+	}
+	defer req.MultipartForm.RemoveAll()
+
+	if req.FormValue("title") != "value" || req.PostForm.Get("title") != "value" {
+		t.Errorf("Expected title field, got %v", req.Form)
+	}
+
+	file, header, err := req.FormFile("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// File larger than maxMemory is stored on disk
+	if _, ok := file.(*os.File); !ok {
+		t.Errorf("Expected file to be stored in a temporary file, got %T", file)
+	}
+	data, _ := io.ReadAll(file)
+	if header.Filename != "upload.txt" || !bytes.Equal(data, content) {
+		t.Errorf("Unexpected file %s with %d bytes", header.Filename, len(data))
+	}
+
+	if _, _, err := req.FormFile("missing"); !errors.Is(err, ErrMissingFile) {
+		t.Errorf("Expected %v, got %v", ErrMissingFile, err)
+	}
+
+	t.Run("not multipart", func(t *testing.T) {
+		req, err := readRequest(bufio.NewReader(strings.NewReader("POST /upload HTTP/1.1\r\n\r\n")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := req.ParseMultipartForm(1024); !errors.Is(err, ErrNotMultipart) {
+			t.Errorf("Expected %v, got %v", ErrNotMultipart, err)
+		}
+	})
+}
+
+func TestMultipartFormCleanup(t *testing.T) {
+	router := NewHTTPRouter()
+	tmpFiles := make(chan string, 1)
+	router.HandlerFunc("POST", "/upload", func(r *HTTPRequest, w ResponseWriter) {
+		if err := r.ParseMultipartForm(16); err != nil {
+			w.SetStatus(StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			w.SetStatus(StatusBadRequest)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		defer file.Close()
+
+		if f, ok := file.(*os.File); ok {
+			tmpFiles <- f.Name()
+		}
+		w.Write([]byte("uploaded"))
+	})
+
+	s, port := startTestServer(t, router)
+	defer s.Shutdown()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	contentType, body := multipartBody(t, "title", "file", bytes.Repeat([]byte("y"), 1024))
+	fmt.Fprintf(conn, "POST /upload HTTP/1.1\r\nConnection: close\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s", contentType, body.Len(), body)
+
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	if !strings.HasSuffix(string(response), "uploaded") {
+		t.Fatalf("Expected successful upload, got %q", response)
+	}
+
+	// Temporary file is removed once request is served
+	name := <-tmpFiles
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("Expected temporary file %s to be removed, got %v", name, err)
+	}
+}
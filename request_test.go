@@ -1,7 +1,12 @@
 package http
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
 	"net"
+	"strings"
 	"testing"
 	"time"
 )
@@ -19,6 +24,18 @@ func MockConn(input string) (net.Conn, net.Conn) {
 	return server, client
 }
 
+// MockConnParts sends input to the server in separate writes
+func MockConnParts(parts ...string) (net.Conn, net.Conn) {
+	server, client := net.Pipe()
+	go func() {
+		defer client.Close()
+		for _, part := range parts {
+			client.Write([]byte(part))
+		}
+	}()
+	return server, client
+}
+
 func TestReadRequest(t *testing.T) {
 	t.Run("normal data", func(t *testing.T) {
 		input := "ale lekki test!"
@@ -89,7 +106,7 @@ func TestParseRequest(t *testing.T) {
 			Method:          "GET",
 			URL:             "/index.html",
 			ProtocolVersion: "HTTP/1.1",
-			Headers:         map[string]string{"Host": "example.com"},
+			Headers:         Header{"Host": {"example.com"}},
 			Body:            []byte{},
 		}
 
@@ -99,7 +116,7 @@ func TestParseRequest(t *testing.T) {
 	})
 
 	t.Run("normal POST request with body", func(t *testing.T) {
-		input := "POST /submit HTTP/1.1\r\nHost: example.com\r\nContent-Type: application/json\r\nContent-Length: 18\r\n\r\n{\"key\":\"value\"}"
+		input := "POST /submit HTTP/1.1\r\nHost: example.com\r\nContent-Type: application/json\r\nContent-Length: 15\r\n\r\n{\"key\":\"value\"}"
 		server, _ := MockConn(input)
 		defer server.Close()
 
@@ -112,10 +129,10 @@ func TestParseRequest(t *testing.T) {
 			Method:          "POST",
 			URL:             "/submit",
 			ProtocolVersion: "HTTP/1.1",
-			Headers: map[string]string{
-				"Host":           "example.com",
-				"Content-Type":   "application/json",
-				"Content-Length": "18",
+			Headers: Header{
+				"Host":           {"example.com"},
+				"Content-Type":   {"application/json"},
+				"Content-Length": {"15"},
 			},
 			Body: []byte("{\"key\":\"value\"}"),
 		}
@@ -126,6 +143,201 @@ func TestParseRequest(t *testing.T) {
 	})
 }
 
+func TestParseRequestHeaders(t *testing.T) {
+	input := "GET / HTTP/1.1\r\nhost: example.com\r\naccept: text/html\r\nACCEPT: application/json\r\nX-Time:  12:30:00 \r\n\r\n"
+	server, _ := MockConn(input)
+	defer server.Close()
+
+	got, err := ParseRequest(server, readTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Headers.Get("Host") != "example.com" {
+		t.Errorf("Expected Host example.com, got %q", got.Headers.Get("Host"))
+	}
+	if accept := got.Headers.Values("Accept"); len(accept) != 2 || accept[0] != "text/html" || accept[1] != "application/json" {
+		t.Errorf("Expected both Accept values, got %v", accept)
+	}
+	if got.Headers.Get("X-Time") != "12:30:00" {
+		t.Errorf("Expected X-Time 12:30:00, got %q", got.Headers.Get("X-Time"))
+	}
+}
+
+func TestParseRequestTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		path     string
+		rawQuery string
+		query    map[string][]string
+	}{
+		{
+			name:   "plain path",
+			target: "/users/42",
+			path:   "/users/42",
+		},
+		{
+			name:     "query string",
+			target:   "/users/42?verbose=1&tag=a&tag=b",
+			path:     "/users/42",
+			rawQuery: "verbose=1&tag=a&tag=b",
+			query:    map[string][]string{"verbose": {"1"}, "tag": {"a", "b"}},
+		},
+		{
+			name:     "percent-encoded",
+			target:   "/files/my%20file.txt?name=J%C3%B3zef+K&q=a%26b",
+			path:     "/files/my file.txt",
+			rawQuery: "name=J%C3%B3zef+K&q=a%26b",
+			query:    map[string][]string{"name": {"Józef K"}, "q": {"a&b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := MockConn("GET " + tt.target + " HTTP/1.1\r\n\r\n")
+			defer server.Close()
+
+			got, err := ParseRequest(server, readTimeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.URL != tt.target || got.Path != tt.path || got.RawQuery != tt.rawQuery {
+				t.Errorf("Expected URL %q path %q query %q, got %q %q %q", tt.target, tt.path, tt.rawQuery, got.URL, got.Path, got.RawQuery)
+			}
+			query := got.Query()
+			for key, values := range tt.query {
+				if len(query[key]) != len(values) {
+					t.Fatalf("Expected %s to be %v, got %v", key, values, query[key])
+				}
+				for i := range values {
+					if query[key][i] != values[i] {
+						t.Errorf("Expected %s to be %v, got %v", key, values, query[key])
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("control characters", func(t *testing.T) {
+		server, _ := MockConn("GET //a\nSet-Cookie:x=1 HTTP/1.1\r\n\r\n")
+		defer server.Close()
+
+		if _, err := ParseRequest(server, readTimeout); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	})
+
+	t.Run("invalid escape", func(t *testing.T) {
+		server, _ := MockConn("GET /files/%zz HTTP/1.1\r\n\r\n")
+		defer server.Close()
+
+		if _, err := ParseRequest(server, readTimeout); err == nil {
+			t.Error("Expected an error, got nil")
+		}
+	})
+}
+
+func TestParseRequestBody(t *testing.T) {
+	t.Run("body split across reads", func(t *testing.T) {
+		body := strings.Repeat("a", 3000)
+		server, _ := MockConnParts(
+			"POST /upload HTTP/1.1\r\nContent-Length: 3000\r\n\r\n",
+			body[:1000],
+			body[1000:],
+		)
+		defer server.Close()
+
+		got, err := ParseRequest(server, readTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got.Body) != body {
+			t.Errorf("Expected body of %d bytes, got %d", len(body), len(got.Body))
+		}
+	})
+
+	t.Run("body with CRLF", func(t *testing.T) {
+		body := "line1\r\nline2\r\n\r\nline3"
+		input := fmt.Sprintf("POST /upload HTTP/1.1\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+		server, _ := MockConn(input)
+		defer server.Close()
+
+		got, err := ParseRequest(server, readTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got.Body) != body {
+			t.Errorf("Expected body %q, got %q", body, got.Body)
+		}
+	})
+
+	t.Run("extra bytes are not part of body", func(t *testing.T) {
+		server, _ := MockConn("POST /upload HTTP/1.1\r\nContent-Length: 3\r\n\r\nabcdef")
+		defer server.Close()
+
+		got, err := ParseRequest(server, readTimeout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got.Body) != "abc" {
+			t.Errorf("Expected body %q, got %q", "abc", got.Body)
+		}
+	})
+
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{
+			name:  "body shorter than Content-Length",
+			input: "POST /upload HTTP/1.1\r\nContent-Length: 10\r\n\r\nabc",
+			want:  ErrBodyLengthMismatch,
+		},
+		{
+			name:  "negative Content-Length",
+			input: "POST /upload HTTP/1.1\r\nContent-Length: -1\r\n\r\n",
+			want:  ErrInvalidContentLength,
+		},
+		{
+			name:  "conflicting Content-Length",
+			input: "POST /upload HTTP/1.1\r\nContent-Length: 3\r\ncontent-length: 4\r\n\r\nabcd",
+			want:  ErrInvalidContentLength,
+		},
+		{
+			name:  "malformed Content-Length",
+			input: "POST /upload HTTP/1.1\r\nContent-Length: ten\r\n\r\n",
+			want:  ErrInvalidContentLength,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := MockConn(tt.input)
+			defer server.Close()
+
+			_, err := ParseRequest(server, readTimeout)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected error %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	t.Run("body times out", func(t *testing.T) {
+		server, client := net.Pipe()
+		defer server.Close()
+		defer client.Close()
+		go client.Write([]byte("POST /upload HTTP/1.1\r\nContent-Length: 10\r\n\r\nabc"))
+
+		_, err := ParseRequest(server, 50*time.Millisecond)
+		if err == nil || !strings.Contains(err.Error(), "read timeout") {
+			t.Errorf("Expected read timeout error, got %v", err)
+		}
+	})
+}
+
 func TestHTTPRequestComparison(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -139,14 +351,14 @@ func TestHTTPRequestComparison(t *testing.T) {
 				Method:          "GET",
 				URL:             "/index.html",
 				ProtocolVersion: "HTTP/1.1",
-				Headers:         map[string]string{"Host": "example.com"},
+				Headers:         Header{"Host": {"example.com"}},
 				Body:            []byte{},
 			},
 			got: HTTPRequest{
 				Method:          "GET",
 				URL:             "/index.html",
 				ProtocolVersion: "HTTP/1.1",
-				Headers:         map[string]string{"Host": "example.com"},
+				Headers:         Header{"Host": {"example.com"}},
 				Body:            []byte{},
 			},
 			equal: true,
@@ -157,14 +369,14 @@ func TestHTTPRequestComparison(t *testing.T) {
 				Method:          "GET",
 				URL:             "/index.html",
 				ProtocolVersion: "HTTP/1.1",
-				Headers:         map[string]string{"Host": "example.com"},
+				Headers:         Header{"Host": {"example.com"}},
 				Body:            []byte{},
 			},
 			got: HTTPRequest{
 				Method:          "POST",
 				URL:             "/index.html",
 				ProtocolVersion: "HTTP/1.1",
-				Headers:         map[string]string{"Host": "example.com"},
+				Headers:         Header{"Host": {"example.com"}},
 				Body:            []byte{},
 			},
 			equal: false,
@@ -175,14 +387,14 @@ func TestHTTPRequestComparison(t *testing.T) {
 				Method:          "GET",
 				URL:             "/index.html",
 				ProtocolVersion: "HTTP/1.1",
-				Headers:         map[string]string{"Host": "example.com"},
+				Headers:         Header{"Host": {"example.com"}},
 				Body:            []byte{},
 			},
 			got: HTTPRequest{
 				Method:          "GET",
 				URL:             "/index.html",
 				ProtocolVersion: "HTTP/1.1",
-				Headers:         map[string]string{"Host": "different.com"},
+				Headers:         Header{"Host": {"different.com"}},
 				Body:            []byte{},
 			},
 			equal: false,
@@ -193,14 +405,14 @@ func TestHTTPRequestComparison(t *testing.T) {
 				Method:          "GET",
 				URL:             "/index.html",
 				ProtocolVersion: "HTTP/1.1",
-				Headers:         map[string]string{"Host": "example.com"},
+				Headers:         Header{"Host": {"example.com"}},
 				Body:            []byte("Hello, world!"),
 			},
 			got: HTTPRequest{
 				Method:          "GET",
 				URL:             "/index.html",
 				ProtocolVersion: "HTTP/1.1",
-				Headers:         map[string]string{"Host": "example.com"},
+				Headers:         Header{"Host": {"example.com"}},
 				Body:            []byte("Hello, Go!"),
 			},
 			equal: false,
@@ -211,14 +423,14 @@ func TestHTTPRequestComparison(t *testing.T) {
 				Method:          "GET",
 				URL:             "/index.html",
 				ProtocolVersion: "HTTP/1.1",
-				Headers:         map[string]string{"Host": "example.com"},
+				Headers:         Header{"Host": {"example.com"}},
 				Body:            []byte{},
 			},
 			got: HTTPRequest{
 				Method:          "GET",
 				URL:             "/about.html",
 				ProtocolVersion: "HTTP/1.1",
-				Headers:         map[string]string{"Host": "example.com"},
+				Headers:         Header{"Host": {"example.com"}},
 				Body:            []byte{},
 			},
 			equal: false,
@@ -232,3 +444,37 @@ func TestHTTPRequestComparison(t *testing.T) {
 		}
 	}
 }
+
+func TestReadRequestPipelined(t *testing.T) {
+	input := "POST /first HTTP/1.1\r\nContent-Length: 5\r\n\r\nfirst" +
+		"POST /second HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n6\r\nsecond\r\n0\r\n\r\n" +
+		"GET /third HTTP/1.1\r\n\r\n"
+	br := bufio.NewReader(strings.NewReader(input))
+
+	want := []struct {
+		url  string
+		body string
+	}{
+		{"/first", "first"},
+		{"/second", "second"},
+		{"/third", ""},
+	}
+
+	for _, w := range want {
+		req, err := readRequest(br)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(req.BodyReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.URL != w.url || string(body) != w.body {
+			t.Errorf("Expected %s with body %q, got %s with body %q", w.url, w.body, req.URL, body)
+		}
+	}
+
+	if _, err := readRequest(br); err != io.EOF {
+		t.Errorf("Expected EOF after last request, got %v", err)
+	}
+}
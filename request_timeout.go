@@ -2,13 +2,19 @@ package http
 
 import (
 	"context"
+	"errors"
 	"log"
+	"sync"
 	"time"
 )
 
+// ErrHandlerTimeout is returned by writes of a handler that exceeded its timeout
+var ErrHandlerTimeout = errors.New("handler timeout")
+
 // TimeoutHandler wraps a HTTPHandler with a timeout
 // If the handler takes longer than time.Duration
 // It will respond with a 504 Gateway Timeout status
+// Response of the handler is buffered and sent once it completes
 func TimeoutHandler(org HTTPHandler, dt time.Duration) HTTPHandler {
 	return func(r *HTTPRequest, w ResponseWriter) {
 		ctx, cancel := context.WithTimeout(r.Context(), dt)
@@ -18,21 +24,102 @@ func TimeoutHandler(org HTTPHandler, dt time.Duration) HTTPHandler {
 		r = r.WithContext(ctx)
 
 		done := make(chan struct{})
+		tw := &timeoutWriter{headers: make(Header)}
 
 		go func() {
 			defer close(done)
-			org(r, w)
+			org(r, tw)
 		}()
 
 		select {
 		case <-done:
 			// Handler completed within the timeout
-			return
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			for key, values := range tw.headers {
+				w.Header()[key] = values
+			}
+			if tw.wroteStatus {
+				w.WriteHeader(tw.statusCode)
+			}
+			w.Write(tw.buf)
 		case <-ctx.Done():
 			// Timeout or cancellation occurred
+			tw.mu.Lock()
+			tw.timedOut = true
+			tw.mu.Unlock()
+
 			log.Printf("Timeout occurred for request to %s", r.URL)
+			// Handler may still read the body, so the connection can't be reused
+			w.SetHeader("Connection", "close")
 			w.SetStatus(504)
 			w.Write([]byte(StatusDescription(504)))
 		}
 	}
 }
+
+// timeoutWriter buffers response of a handler run by TimeoutHandler
+// Writes after the timeout are dropped
+type timeoutWriter struct {
+	mu          sync.Mutex
+	headers     Header
+	statusCode  int
+	wroteStatus bool
+	timedOut    bool
+	buf         []byte
+}
+
+// Write appends to the buffered body
+func (tw *timeoutWriter) Write(body []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, ErrHandlerTimeout
+	}
+	tw.buf = append(tw.buf, body...)
+	return len(body), nil
+}
+
+// SetStatus sets status code of the buffered response
+func (tw *timeoutWriter) SetStatus(statusCode int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if !tw.wroteStatus && !tw.timedOut {
+		tw.statusCode = statusCode
+		tw.wroteStatus = true
+	}
+}
+
+// SetHeader sets header of the buffered response
+func (tw *timeoutWriter) SetHeader(key, value string) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if !tw.timedOut {
+		tw.headers.Set(key, value)
+	}
+}
+
+// Header returns headers of the buffered response
+func (tw *timeoutWriter) Header() Header {
+	return tw.headers
+}
+
+// WriteHeader sets status code, headers are sent when handler completes
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.SetStatus(statusCode)
+}
+
+// Flush does nothing, response is sent when handler completes
+func (tw *timeoutWriter) Flush() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return ErrHandlerTimeout
+	}
+	return nil
+}
@@ -63,13 +63,13 @@ func TestTimeoutHandler(t *testing.T) {
 	}{
 		{
 			name:         "Request times out",
-			request:      "GET /timeout HTTP/1.1\r\n\r\n",
+			request:      "GET /timeout HTTP/1.1\r\nConnection: close\r\n\r\n",
 			expectedBody: "Gateway Timeout",
 			expectedCode: "504",
 		},
 		{
 			name:         "Request succeeds",
-			request:      "GET /ok HTTP/1.1\r\n\r\n",
+			request:      "GET /ok HTTP/1.1\r\nConnection: close\r\n\r\n",
 			expectedBody: "Fast Response",
 			expectedCode: "200",
 		},
@@ -1,48 +1,30 @@
 package http
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"log"
 	"net"
-	"sort"
+	"strconv"
 	"time"
 )
 
-// Status codes
-const (
-	StatusOK             = 200
-	StatusCreated        = 201
-	StatusBadRequest     = 400
-	StatusNotFound       = 404
-	StatusRequestTimeout = 408
-	StatusServerError    = 500
-	StatusGatewayTimeout = 504
-)
+// bufferSize is how much body is kept before headers are sent
+// Bodies that fit are sent with Content-Length, longer ones are streamed
+const bufferSize = 4096
 
-// StatusDescription returns a status description for the given status code
-func StatusDescription(code int) string {
-	switch code {
-	case 200:
-		return "OK"
-	case 201:
-		return "Created"
-	case 400:
-		return "Bad Request"
-	case 404:
-		return "Not Found"
-	case 408:
-		return "Request Timeout"
-	case 500:
-		return "Internal Server Error"
-	case 504:
-		return "Gateway Timeout"
-	default:
-		return ""
-	}
-}
+// Errors returned by DefaultResponseWriter
+var (
+	ErrBodyNotAllowed   = errors.New("response status doesn't allow body")
+	ErrContentLength    = errors.New("body length doesn't match Content-Length")
+	ErrResponseFinished = errors.New("response already finished")
+)
 
 // ResponseWriter provides methods to construct and send the HTTP response
 type ResponseWriter interface {
 	// Write writes the byte slice to the response body
+	// It can be called multiple times, each call appends to the body
 	Write([]byte) (int, error)
 
 	// SetStatus sets the HTTP status code for the response
@@ -50,95 +32,279 @@ type ResponseWriter interface {
 
 	// SetHeader sets a key-value pair in the HTTP response headers
 	SetHeader(key, value string)
+
+	// Header returns the response headers, changes after headers are committed have no effect
+	Header() Header
+
+	// WriteHeader sets the status code and commits headers
+	// It's called with 200 by the first Write if handler didn't call it
+	WriteHeader(statusCode int)
+
+	// Flush sends headers and buffered body to the client
+	// Body without Content-Length is sent with chunked encoding from then on
+	Flush() error
 }
 
 // DefaultResponseWriter implements ResponseWriter interface
+// Body is buffered until Flush, Finish or bufferSize bytes were written
 type DefaultResponseWriter struct {
-	conn         net.Conn
-	statusCode   int
-	headers      map[string]string
-	wroteStatus  bool
-	writeTimeout time.Duration
+	conn          net.Conn
+	statusCode    int
+	headers       Header
+	sentHeaders   Header // copy of headers taken by WriteHeader
+	wroteStatus   bool
+	wroteHeader   bool // headers are committed
+	headSent      bool // status line and headers reached the connection
+	finished      bool
+	chunked       bool
+	closeAfter    bool  // body is delimited by closing the connection
+	noChunking    bool  // client doesn't understand chunked encoding (HTTP/1.0)
+	noBody        bool  // response to HEAD, body is counted but not sent
+	contentLength int64 // declared Content-Length or -1
+	bodyWritten   int64
+	buf           []byte
+	writeTimeout  time.Duration
+	closing       func() bool // reports whether the server is shutting down
 }
 
 // NewResponseWriter returns new response writer
 func NewResponseWriter(conn net.Conn, writeTimeout time.Duration) *DefaultResponseWriter {
 	return &DefaultResponseWriter{
-		conn:         conn,
-		headers:      make(map[string]string),
-		writeTimeout: writeTimeout,
+		conn:          conn,
+		headers:       make(Header),
+		contentLength: -1,
+		writeTimeout:  writeTimeout,
 	}
 }
 
 // SetStatus writes status code of response
+// Codes outside 100-599 are replaced with 500
 func (rw *DefaultResponseWriter) SetStatus(statusCode int) {
 	if rw.wroteStatus {
 		return
 	}
+	if !validStatus(statusCode) {
+		log.Printf("Invalid status code %d, sending 500", statusCode)
+		statusCode = StatusInternalServerError
+	}
 	rw.statusCode = statusCode
 	rw.wroteStatus = true
 }
 
 // SetHeader sets headers
 func (rw *DefaultResponseWriter) SetHeader(key, value string) {
-	rw.headers[key] = value
+	rw.headers.Set(key, value)
+}
+
+// Header returns response headers
+func (rw *DefaultResponseWriter) Header() Header {
+	return rw.headers
 }
 
-// Write sends resonse to client
+// WriteHeader sets status code and commits headers, it has effect only once
+func (rw *DefaultResponseWriter) WriteHeader(statusCode int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.SetStatus(statusCode)
+	rw.wroteHeader = true
+	rw.sentHeaders = rw.headers.clone()
+
+	// 1xx, 204 and 304 responses end after headers
+	if bodyAllowedForStatus(rw.statusCode) {
+		// Set default content type
+		if !rw.sentHeaders.has("Content-Type") {
+			rw.sentHeaders.Set("Content-Type", "text/plain")
+		}
+	} else if rw.statusCode != StatusNotModified {
+		// 304 may describe the selected representation, others can't have it at all
+		rw.sentHeaders.Del("Content-Length")
+	}
+
+	// Content-Length set by the handler limits the body
+	if cl := rw.sentHeaders.Get("Content-Length"); cl != "" && bodyAllowedForStatus(rw.statusCode) {
+		if n, err := strconv.ParseInt(cl, 10, 64); err == nil && n >= 0 {
+			rw.contentLength = n
+		} else {
+			log.Printf("Invalid Content-Length %q in response, removing it", cl)
+			rw.sentHeaders.Del("Content-Length")
+		}
+	}
+}
+
+// Write appends body to the response
+// Headers are committed with status 200 if WriteHeader wasn't called yet
 func (rw *DefaultResponseWriter) Write(body []byte) (int, error) {
+	if rw.finished {
+		return 0, ErrResponseFinished
+	}
 	// Set default status
-	if !rw.wroteStatus {
-		rw.SetStatus(200)
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
 	}
 
-	// Set default content type
-	if _, exists := rw.headers["Content-Type"]; !exists {
-		rw.SetHeader("Content-Type", "text/plain")
+	if !bodyAllowedForStatus(rw.statusCode) {
+		if len(body) > 0 {
+			return 0, ErrBodyNotAllowed
+		}
+		return 0, nil
 	}
 
-	// Set Content-Length
-	if _, exists := rw.headers["Content-Length"]; !exists {
-		rw.SetHeader("Content-Length", fmt.Sprintf("%d", len(body)))
+	if rw.contentLength >= 0 && rw.bodyWritten+int64(len(body)) > rw.contentLength {
+		return 0, fmt.Errorf("%w: %d bytes declared", ErrContentLength, rw.contentLength)
 	}
 
-	// Set write deadlines
-	rw.conn.SetWriteDeadline(time.Now().Add(rw.writeTimeout))
-	defer rw.conn.SetWriteDeadline(time.Time{})
+	rw.bodyWritten += int64(len(body))
+	if rw.noBody {
+		return len(body), nil
+	}
+	rw.buf = append(rw.buf, body...)
+	if len(rw.buf) >= bufferSize {
+		if err := rw.Flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(body), nil
+}
 
-	// Write status
-	responseLine := fmt.Sprintf("HTTP/1.1 %d %s\r\n", rw.statusCode, StatusDescription(rw.statusCode))
-	if _, err := rw.conn.Write([]byte(responseLine)); err != nil {
-		return 0, fmt.Errorf("failed to write response line: %w", err)
+// Flush sends headers and buffered body to the client
+func (rw *DefaultResponseWriter) Flush() error {
+	if rw.finished {
+		return ErrResponseFinished
+	}
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
 	}
 
-	// Get the header keys and sort them
-	keys := make([]string, 0, len(rw.headers))
-	for key := range rw.headers {
-		keys = append(keys, key)
+	var out bytes.Buffer
+	if !rw.headSent {
+		// Length of the body isn't known yet
+		if rw.contentLength < 0 && bodyAllowedForStatus(rw.statusCode) {
+			if rw.noChunking {
+				rw.closeAfter = true
+				rw.sentHeaders.Set("Connection", "close")
+			} else {
+				rw.chunked = true
+				rw.sentHeaders.Set("Transfer-Encoding", "chunked")
+			}
+		}
+		rw.writeHead(&out)
 	}
-	sort.Strings(keys)
+	rw.writeBuffered(&out)
 
-	rw.conn.SetWriteDeadline(time.Now().Add(rw.writeTimeout))
-	// Write headers in sorted order
-	for _, key := range keys {
-		headerLine := fmt.Sprintf("%s: %s\r\n", key, rw.headers[key])
-		if _, err := rw.conn.Write([]byte(headerLine)); err != nil {
-			return 0, fmt.Errorf("failed to write header: %w", err)
+	return rw.send(out.Bytes())
+}
+
+// Finish completes the response, server calls it after the handler returns
+// Body that was never flushed is sent with Content-Length
+func (rw *DefaultResponseWriter) Finish() error {
+	if rw.finished {
+		return nil
+	}
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
+	}
+	rw.finished = true
+
+	var out bytes.Buffer
+	if !rw.headSent {
+		if rw.contentLength < 0 && bodyAllowedForStatus(rw.statusCode) {
+			rw.contentLength = rw.bodyWritten
+			rw.sentHeaders.Set("Content-Length", strconv.FormatInt(rw.bodyWritten, 10))
 		}
+		rw.writeHead(&out)
 	}
+	rw.writeBuffered(&out)
 
-	rw.conn.SetWriteDeadline(time.Now().Add(rw.writeTimeout))
-	// Write \r\n between headers and body
-	if _, err := rw.conn.Write([]byte("\r\n")); err != nil {
-		return 0, fmt.Errorf("failed to write blank line after headers: %w", err)
+	// Write the last chunk
+	if rw.chunked && !rw.noBody {
+		out.WriteString("0" + CRLF + CRLF)
 	}
 
-	rw.conn.SetWriteDeadline(time.Now().Add(rw.writeTimeout))
-	// Write body
-	n, err := rw.conn.Write(body)
-	if err != nil {
-		return n, fmt.Errorf("failed to write body: %w", err)
+	if err := rw.send(out.Bytes()); err != nil {
+		return err
+	}
+
+	// Client would wait for the missing bytes
+	if rw.contentLength >= 0 && rw.bodyWritten < rw.contentLength && !rw.noBody {
+		rw.closeAfter = true
+		return fmt.Errorf("%w: wrote %d of %d bytes", ErrContentLength, rw.bodyWritten, rw.contentLength)
+	}
+
+	return nil
+}
+
+// reset drops status, headers and body that weren't sent yet
+// Returns false if the head already reached the connection
+func (rw *DefaultResponseWriter) reset() bool {
+	if rw.headSent {
+		return false
+	}
+	*rw = DefaultResponseWriter{
+		conn:          rw.conn,
+		headers:       make(Header),
+		contentLength: -1,
+		writeTimeout:  rw.writeTimeout,
+		noChunking:    rw.noChunking,
+		noBody:        rw.noBody,
+		closing:       rw.closing,
+	}
+	return true
+}
+
+// closeRequested reports whether the connection has to be closed after the response
+func (rw *DefaultResponseWriter) closeRequested() bool {
+	if rw.closeAfter {
+		return true
+	}
+	if rw.wroteHeader {
+		return rw.sentHeaders.hasToken("Connection", "close")
+	}
+	return rw.headers.hasToken("Connection", "close")
+}
+
+// writeHead writes status line and committed headers to out
+// Client is told to close the connection if the server started shutting down meanwhile
+func (rw *DefaultResponseWriter) writeHead(out *bytes.Buffer) {
+	if rw.closing != nil && rw.closing() {
+		rw.sentHeaders.Set("Connection", "close")
 	}
+	fmt.Fprintf(out, "HTTP/1.1 %d %s\r\n", rw.statusCode, StatusDescription(rw.statusCode))
+	rw.sentHeaders.write(out)
+	out.WriteString(CRLF)
+	rw.headSent = true
+}
 
-	return n, nil
+// writeBuffered moves buffered body to out, framed as a chunk if needed
+func (rw *DefaultResponseWriter) writeBuffered(out *bytes.Buffer) {
+	if len(rw.buf) == 0 {
+		return
+	}
+
+	if rw.chunked {
+		fmt.Fprintf(out, "%x\r\n", len(rw.buf))
+	}
+	out.Write(rw.buf)
+	if rw.chunked {
+		out.WriteString(CRLF)
+	}
+	rw.buf = rw.buf[:0]
+}
+
+// send writes data to the connection within writeTimeout
+func (rw *DefaultResponseWriter) send(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	// Set write deadlines
+	rw.conn.SetWriteDeadline(time.Now().Add(rw.writeTimeout))
+	defer rw.conn.SetWriteDeadline(time.Time{})
+
+	if _, err := rw.conn.Write(data); err != nil {
+		rw.closeAfter = true
+		return fmt.Errorf("failed to write response: %w", err)
+	}
+	return nil
 }
@@ -1,36 +1,17 @@
 package http
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"strings"
 	"testing"
 	"time"
 )
 
 const writeTimeout = 5 * time.Second
 
-func TestStatusDescription(t *testing.T) {
-	tests := []struct {
-		input    int
-		expected string
-	}{
-		{200, "OK"},
-		{201, "Created"},
-		{400, "Bad Request"},
-		{404, "Not Found"},
-		{408, "Request Timeout"},
-		{500, "Internal Server Error"},
-		{504, "Gateway Timeout"},
-		{1337, ""},
-	}
-
-	for _, v := range tests {
-		if got := StatusDescription(v.input); got != v.expected {
-			t.Errorf("Failed test [%d], want %s got %s\n", v.input, v.expected, got)
-		}
-	}
-}
-
 func TestResponseWriter_Write(t *testing.T) {
 	serverConn, clientConn := net.Pipe()
 	defer clientConn.Close()
@@ -41,6 +22,9 @@ func TestResponseWriter_Write(t *testing.T) {
 		if _, err := rw.Write([]byte("Hello, world!")); err != nil {
 			t.Errorf("Write error: %s", err)
 		}
+		if err := rw.Finish(); err != nil {
+			t.Errorf("Finish error: %s", err)
+		}
 	}()
 
 	// Read response
@@ -55,3 +39,239 @@ func TestResponseWriter_Write(t *testing.T) {
 		t.Errorf("Write() output = %q, want %q", got, expected)
 	}
 }
+
+func TestResponseWriter_Header(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	go func() {
+		defer serverConn.Close()
+		rw := NewResponseWriter(serverConn, writeTimeout)
+		rw.SetHeader("content-type", "application/json")
+		rw.Header().Add("Set-Cookie", "a=1")
+		rw.Header().Add("set-cookie", "b=2")
+		if _, err := rw.Write([]byte("{}")); err != nil {
+			t.Errorf("Write error: %s", err)
+		}
+		if err := rw.Finish(); err != nil {
+			t.Errorf("Finish error: %s", err)
+		}
+	}()
+
+	in, err := io.ReadAll(clientConn)
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+
+	expected := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nContent-Type: application/json\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\n\r\n{}"
+	if got := string(in); got != expected {
+		t.Errorf("Write() output = %q, want %q", got, expected)
+	}
+}
+
+func TestResponseWriter_Status(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		headers  map[string]string
+		body     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "service unavailable",
+			status:   503,
+			body:     "down",
+			expected: "HTTP/1.1 503 Service Unavailable\r\nContent-Length: 4\r\nContent-Type: text/plain\r\n\r\ndown",
+		},
+		{
+			name:     "unregistered code",
+			status:   499,
+			expected: "HTTP/1.1 499 Client Error\r\nContent-Length: 0\r\nContent-Type: text/plain\r\n\r\n",
+		},
+		{
+			name:     "invalid code",
+			status:   1337,
+			expected: "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 0\r\nContent-Type: text/plain\r\n\r\n",
+		},
+		{
+			name:     "no content drops body and length",
+			status:   204,
+			headers:  map[string]string{"Content-Length": "4"},
+			body:     "body",
+			err:      ErrBodyNotAllowed,
+			expected: "HTTP/1.1 204 No Content\r\n\r\n",
+		},
+		{
+			name:     "not modified keeps explicit length",
+			status:   304,
+			headers:  map[string]string{"Content-Length": "10", "Etag": `"v1"`},
+			expected: "HTTP/1.1 304 Not Modified\r\nContent-Length: 10\r\nEtag: \"v1\"\r\n\r\n",
+		},
+		{
+			name:     "informational",
+			status:   101,
+			headers:  map[string]string{"Upgrade": "websocket"},
+			expected: "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConn, clientConn := net.Pipe()
+			defer clientConn.Close()
+
+			go func() {
+				defer serverConn.Close()
+				rw := NewResponseWriter(serverConn, writeTimeout)
+				for k, v := range tt.headers {
+					rw.SetHeader(k, v)
+				}
+				rw.SetStatus(tt.status)
+				if _, err := rw.Write([]byte(tt.body)); err != tt.err {
+					t.Errorf("Expected error %v, got %v", tt.err, err)
+				}
+				if err := rw.Finish(); err != nil {
+					t.Errorf("Finish error: %s", err)
+				}
+			}()
+
+			in, err := io.ReadAll(clientConn)
+			if err != nil {
+				t.Fatalf("failed to read: %s", err)
+			}
+			if got := string(in); got != tt.expected {
+				t.Errorf("Write() output = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+// writeResponse runs f with a response writer and returns what reached the client
+func writeResponse(t *testing.T, f func(rw *DefaultResponseWriter)) string {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	go func() {
+		defer serverConn.Close()
+		f(NewResponseWriter(serverConn, writeTimeout))
+	}()
+
+	in, err := io.ReadAll(clientConn)
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	return string(in)
+}
+
+func TestResponseWriter_Streaming(t *testing.T) {
+	tests := []struct {
+		name     string
+		write    func(rw *DefaultResponseWriter)
+		expected string
+	}{
+		{
+			name: "multiple writes",
+			write: func(rw *DefaultResponseWriter) {
+				rw.Write([]byte("Hello, "))
+				rw.Write([]byte("world!"))
+				rw.Finish()
+			},
+			expected: "HTTP/1.1 200 OK\r\nContent-Length: 13\r\nContent-Type: text/plain\r\n\r\nHello, world!",
+		},
+		{
+			name: "flush switches to chunked",
+			write: func(rw *DefaultResponseWriter) {
+				rw.Write([]byte("first"))
+				rw.Flush()
+				rw.Write([]byte("second"))
+				rw.Finish()
+			},
+			expected: "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"5\r\nfirst\r\n6\r\nsecond\r\n0\r\n\r\n",
+		},
+		{
+			name: "flush with Content-Length",
+			write: func(rw *DefaultResponseWriter) {
+				rw.SetHeader("Content-Length", "11")
+				rw.Write([]byte("first"))
+				rw.Flush()
+				rw.Write([]byte("second"))
+				rw.Finish()
+			},
+			expected: "HTTP/1.1 200 OK\r\nContent-Length: 11\r\nContent-Type: text/plain\r\n\r\nfirstsecond",
+		},
+		{
+			name: "flush without chunking support",
+			write: func(rw *DefaultResponseWriter) {
+				rw.noChunking = true
+				rw.Write([]byte("first"))
+				rw.Flush()
+				rw.Write([]byte("second"))
+				rw.Finish()
+				if !rw.closeRequested() {
+					t.Error("Expected connection to be closed after close-delimited body")
+				}
+			},
+			expected: "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Type: text/plain\r\n\r\nfirstsecond",
+		},
+		{
+			name: "headers are committed by WriteHeader",
+			write: func(rw *DefaultResponseWriter) {
+				rw.SetHeader("X-Before", "1")
+				rw.WriteHeader(StatusCreated)
+				rw.SetHeader("X-After", "1")
+				rw.SetStatus(StatusAccepted)
+				rw.Write([]byte("ok"))
+				rw.Finish()
+			},
+			expected: "HTTP/1.1 201 Created\r\nContent-Length: 2\r\nContent-Type: text/plain\r\nX-Before: 1\r\n\r\nok",
+		},
+		{
+			name: "empty response",
+			write: func(rw *DefaultResponseWriter) {
+				rw.Finish()
+			},
+			expected: "HTTP/1.1 200 OK\r\nContent-Length: 0\r\nContent-Type: text/plain\r\n\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := writeResponse(t, tt.write); got != tt.expected {
+				t.Errorf("output = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResponseWriter_LargeBody(t *testing.T) {
+	body := strings.Repeat("x", bufferSize+10)
+	got := writeResponse(t, func(rw *DefaultResponseWriter) {
+		rw.Write([]byte(body))
+		rw.Finish()
+	})
+
+	// Body over the buffer size is streamed in chunks
+	expected := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n%x\r\n%s\r\n0\r\n\r\n", len(body), body)
+	if got != expected {
+		t.Errorf("Unexpected chunked output of %d bytes", len(got))
+	}
+}
+
+func TestResponseWriter_Errors(t *testing.T) {
+	writeResponse(t, func(rw *DefaultResponseWriter) {
+		rw.SetHeader("Content-Length", "3")
+		if _, err := rw.Write([]byte("toolong")); !errors.Is(err, ErrContentLength) {
+			t.Errorf("Expected %v, got %v", ErrContentLength, err)
+		}
+		rw.Write([]byte("ab"))
+		if err := rw.Finish(); !errors.Is(err, ErrContentLength) {
+			t.Errorf("Expected %v for short body, got %v", ErrContentLength, err)
+		}
+		if _, err := rw.Write([]byte("c")); !errors.Is(err, ErrResponseFinished) {
+			t.Errorf("Expected %v, got %v", ErrResponseFinished, err)
+		}
+	})
+}
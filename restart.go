@@ -0,0 +1,250 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Environment variables used to hand listeners to the restarted process
+const (
+	// listenersEnv holds addresses of inherited listeners separated by "\n", in fd order from 3
+	listenersEnv = "HTTP_INHERITED_LISTENERS"
+
+	// readyFdEnv holds fd of the pipe closed by the child once it serves
+	readyFdEnv = "HTTP_READY_FD"
+)
+
+// addrListener is a listener opened for a server address
+type addrListener struct {
+	addr     string
+	listener net.Listener
+}
+
+// Restart starts a new process of the program handing it the listening sockets
+// Child adopts a socket when it listens on the same address with ListenAndServe,
+// once it serves, this server stops accepting and drains connections within ShutdownTimeout
+// Server keeps serving if the child fails or doesn't get ready before ctx is done
+func (s *Server) Restart(ctx context.Context) error {
+	s.mu.Lock()
+	handoff := append([]addrListener(nil), s.handoff...)
+	s.mu.Unlock()
+	if len(handoff) == 0 {
+		return errors.New("restart: no listeners opened by ListenAndServe")
+	}
+
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	addrs := make([]string, 0, len(handoff))
+	for _, h := range handoff {
+		f, err := listenerFile(h.listener)
+		if err != nil {
+			return fmt.Errorf("restart: listener %s: %w", h.addr, err)
+		}
+		files = append(files, f)
+		addrs = append(addrs, h.addr)
+	}
+
+	ready, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("restart: %w", err)
+	}
+	defer ready.Close()
+
+	args := s.RestartCommand
+	if len(args) == 0 {
+		args = os.Args
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, readyW)
+	cmd.Env = append(inheritableEnviron(),
+		listenersEnv+"="+strings.Join(addrs, "\n"),
+		readyFdEnv+"="+strconv.Itoa(listenFdsStart+len(files)),
+	)
+	err = cmd.Start()
+	readyW.Close()
+	// Passing the files to the child switched the shared sockets to blocking mode,
+	// accept of this server wouldn't be interrupted by Close
+	for _, h := range handoff {
+		setNonblock(h.listener)
+	}
+	if err != nil {
+		return fmt.Errorf("restart: %w", err)
+	}
+
+	// Child writes a byte when it serves, EOF means it exited before that
+	readyc := make(chan bool, 1)
+	go func() {
+		buf := make([]byte, 1)
+		n, _ := ready.Read(buf)
+		readyc <- n == 1
+	}()
+
+	select {
+	case ok := <-readyc:
+		if !ok {
+			err := cmd.Wait()
+			return fmt.Errorf("restart: child exited before serving: %v", err)
+		}
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("restart: child not ready: %w", ctx.Err())
+	}
+
+	log.Printf("Process %d took over listeners, draining connections", cmd.Process.Pid)
+	// Child isn't waited for, it outlives this process
+	cmd.Process.Release()
+	s.Shutdown()
+	return nil
+}
+
+// restartOnHangup restarts the server on SIGHUP until ctx is done
+func (s *Server) restartOnHangup(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			restartCtx, cancel := context.WithTimeout(ctx, s.ShutdownTimeout)
+			err := s.Restart(restartCtx)
+			cancel()
+			if err != nil {
+				log.Printf("Restart failed, still serving: %v", err)
+				continue
+			}
+			return
+		}
+	}
+}
+
+// trackHandoff remembers listener opened for addr, so Restart can hand it over
+func (s *Server) trackHandoff(addr string, l net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handoff = append(s.handoff, addrListener{addr: addr, listener: l})
+}
+
+// listenerFile returns duplicate of the listener socket for a child process
+func listenerFile(l net.Listener) (*os.File, error) {
+	switch l := l.(type) {
+	case *net.TCPListener:
+		return l.File()
+	case *net.UnixListener:
+		// Socket file has to stay for the child
+		l.SetUnlinkOnClose(false)
+		return l.File()
+	}
+	return nil, fmt.Errorf("can't hand over %T", l)
+}
+
+// setNonblock puts listener socket back to non-blocking mode
+func setNonblock(l net.Listener) {
+	sc, ok := l.(syscall.Conn)
+	if !ok {
+		return
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return
+	}
+	raw.Control(func(fd uintptr) {
+		syscall.SetNonblock(int(fd), true)
+	})
+}
+
+// inheritableEnviron returns environment without variables of a previous handoff
+func inheritableEnviron() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, listenersEnv+"=") || strings.HasPrefix(kv, readyFdEnv+"=") {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+// inherited holds listeners handed over by the parent process
+var inherited struct {
+	once      sync.Once
+	mu        sync.Mutex
+	addrs     []string
+	listeners []net.Listener
+	readyFd   int
+	ready     sync.Once
+}
+
+// inheritedListener returns listener handed over by the parent for addr or nil
+// Every listener can be taken only once
+func inheritedListener(addr string) net.Listener {
+	adoptInherited()
+
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	for i, a := range inherited.addrs {
+		if a == addr && inherited.listeners[i] != nil {
+			l := inherited.listeners[i]
+			inherited.listeners[i] = nil
+			return l
+		}
+	}
+	return nil
+}
+
+// adoptInherited turns fds from the parent into listeners on the first call
+func adoptInherited() {
+	inherited.once.Do(func() {
+		value := os.Getenv(listenersEnv)
+		readyFd, _ := strconv.Atoi(os.Getenv(readyFdEnv))
+		os.Unsetenv(listenersEnv)
+		os.Unsetenv(readyFdEnv)
+		inherited.readyFd = readyFd
+		if value == "" {
+			return
+		}
+
+		for i, addr := range strings.Split(value, "\n") {
+			file := os.NewFile(uintptr(listenFdsStart+i), addr)
+			l, err := net.FileListener(file)
+			file.Close()
+			if err != nil {
+				log.Printf("Failed to adopt inherited listener %s: %v", addr, err)
+				continue
+			}
+			inherited.addrs = append(inherited.addrs, addr)
+			inherited.listeners = append(inherited.listeners, l)
+		}
+	})
+}
+
+// notifyReady tells the parent process that listeners are served
+func notifyReady() {
+	adoptInherited()
+	inherited.ready.Do(func() {
+		if inherited.readyFd < listenFdsStart {
+			return
+		}
+		f := os.NewFile(uintptr(inherited.readyFd), "ready")
+		f.Write([]byte{1})
+		f.Close()
+	})
+}
@@ -0,0 +1,157 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// getBody sends GET for path to addr and returns body of the response
+func getBody(t *testing.T, addr, path string) string {
+	t.Helper()
+	conn := dialRetry(t, "tcp", addr)
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nConnection: close\r\n\r\n", path)
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	_, body, _ := strings.Cut(string(response), "\r\n\r\n")
+	return body
+}
+
+func TestRestartHelperProcess(t *testing.T) {
+	if os.Getenv("HTTP_TEST_RESTART_CHILD") != "1" {
+		t.Skip("helper process")
+	}
+
+	router := NewHTTPRouter()
+	router.HandlerFunc("GET", "/pid", func(r *HTTPRequest, w ResponseWriter) {
+		w.Write([]byte(fmt.Sprintf("child %d", os.Getpid())))
+	})
+	s := NewServer("localhost:0", router)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	t.Setenv("HTTP_TEST_RESTART_CHILD", "1")
+
+	release := make(chan struct{})
+	router := NewHTTPRouter()
+	router.HandlerFunc("GET", "/pid", func(r *HTTPRequest, w ResponseWriter) {
+		w.Write([]byte("parent"))
+	})
+	router.HandlerFunc("GET", "/slow", func(r *HTTPRequest, w ResponseWriter) {
+		<-release
+		w.Write([]byte("slow"))
+	})
+	s := NewServer("localhost:0", router)
+	s.RestartCommand = []string{os.Args[0], "-test.run=^TestRestartHelperProcess$"}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.ListenAndServe(context.Background())
+	}()
+	addr := fmt.Sprintf("localhost:%d", waitForServer(t, s))
+	if body := getBody(t, addr, "/pid"); body != "parent" {
+		t.Fatalf("Expected parent response, got %q", body)
+	}
+
+	// Request in flight during the handoff
+	slow := make(chan string, 1)
+	go func() {
+		slow <- getBody(t, addr, "/slow")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	restarted := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		restarted <- s.Restart(ctx)
+	}()
+
+	// New connections reach the child while the parent drains
+	var pid int
+	deadline := time.Now().Add(10 * time.Second)
+	for pid == 0 && time.Now().Before(deadline) {
+		if body := getBody(t, addr, "/pid"); strings.HasPrefix(body, "child ") {
+			pid, _ = strconv.Atoi(strings.TrimPrefix(body, "child "))
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if pid == 0 {
+		t.Fatal("Child process didn't take over the listener")
+	}
+	child, err := os.FindProcess(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		child.Signal(syscall.SIGTERM)
+		child.Wait()
+	}()
+
+	// Parent keeps running while its in-flight request drains
+	for s.serverCtx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case err := <-served:
+		t.Fatalf("ListenAndServe returned before in-flight request finished: %v", err)
+	default:
+	}
+
+	close(release)
+	if body := <-slow; body != "slow" {
+		t.Errorf("Expected in-flight request to complete, got %q", body)
+	}
+	if err := <-restarted; err != nil {
+		t.Errorf("Expected restart to succeed, got %v", err)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Expected nil from ListenAndServe after handoff, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("ListenAndServe didn't return after handoff")
+	}
+	if body := getBody(t, addr, "/pid"); body != fmt.Sprintf("child %d", pid) {
+		t.Errorf("Expected child to keep serving, got %q", body)
+	}
+}
+
+func TestRestartFailedChild(t *testing.T) {
+	s, _ := startTestServer(t, NewHTTPRouter())
+	defer s.Shutdown()
+	if err := s.Restart(context.Background()); err == nil {
+		t.Error("Expected error without listeners opened by ListenAndServe")
+	}
+
+	s = NewServer("localhost:0", NewHTTPRouter())
+	s.RestartCommand = []string{"/bin/false"}
+	go s.ListenAndServe(context.Background())
+	defer s.Shutdown()
+	port := waitForServer(t, s)
+
+	if err := s.Restart(context.Background()); err == nil {
+		t.Error("Expected error when child exits before serving")
+	}
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatalf("Expected server to keep serving after failed restart: %v", err)
+	}
+	conn.Close()
+}
@@ -1,84 +1,333 @@
 package http
 
-import "strings"
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
 
 // HTTPHandler defines signature of func that handles requests
 type HTTPHandler func(*HTTPRequest, ResponseWriter)
 
 // Route represents a single HTTP route in the router
 type Route struct {
-	method     string
-	pathParts  []string
-	handler    HTTPHandler
-	paramNames []string
+	method      string
+	pathParts   []string
+	handler     HTTPHandler
+	paramNames  []string
+	constraints []*regexp.Regexp
+	catchAll    bool // last param captures the rest of the path
+	slash       bool // path ends with slash
+	name        string
+	router      *HTTPRouter
+	host        *hostRoutes  // nil for routes serving any host
+	middleware  []Middleware // group middleware wrapping handler
+}
+
+// pattern returns the path the route was registered with
+func (r *Route) pattern() string {
+	if r.slash {
+		return "/" + strings.Join(r.pathParts, "/") + "/"
+	}
+	return "/" + strings.Join(r.pathParts, "/")
+}
+
+// Name names the route, so its URL can be built with HTTPRouter.URL
+// It panics if the name is already used by another route of the router
+func (r *Route) Name(name string) *Route {
+	if other, ok := r.router.names[name]; ok && other != r {
+		panic(fmt.Sprintf("http: route name %q already used by %s %s", name, other.method, other.pattern()))
+	}
+	if r.name != "" {
+		delete(r.router.names, r.name)
+	}
+	if r.router.names == nil {
+		r.router.names = make(map[string]*Route)
+	}
+	r.router.names[name] = r
+	r.name = name
+	return r
 }
 
 // HTTPRouter is a router for managing routes and their handlers
+// Routes are kept in a prefix tree per method, static segments
+// have priority over parameters regardless of registration order
+// Routes registered with Host are tried before the ones serving any host
 type HTTPRouter struct {
-	routes []Route
+	routes     []*Route
+	trees      map[string]*node
+	hosts      []*hostRoutes
+	names      map[string]*Route
+	middleware []Middleware
+	handler    HTTPHandler // dispatch wrapped with middleware
+
+	// NotFound responds to paths without any route, reason wraps ErrNotFound
+	NotFound ErrorHandler
+
+	// MethodNotAllowed responds to paths registered only for other methods,
+	// reason wraps ErrMethodNotAllowed and Allow header is already set
+	MethodNotAllowed ErrorHandler
+
+	// DefaultHost is used for requests with Host not matching any host pattern,
+	// including requests without Host header
+	DefaultHost string
+
+	// TrailingSlash decides if "/users/" is served by "/users" route and the other way around,
+	// by default the client is redirected to the registered form
+	TrailingSlash TrailingSlashPolicy
 }
 
 // NewHTTPRouter return new HTTPRouter
 func NewHTTPRouter() *HTTPRouter {
 	return &HTTPRouter{
-		routes: make([]Route, 0),
+		routes: make([]*Route, 0),
+		trees:  make(map[string]*node),
+		names:  make(map[string]*Route),
 	}
 }
 
 // HandlerFunc adds a new route to the HTTPRouter
 // - method: HTTP method for the route "GET", "POST", etc.
-// - path: URL path for the route (dynamic parameters "/users/{id}")
+// - path: URL path for the route, parameters can be:
+//   - "/users/{id}" matches a single segment
+//   - "/users/{id:[0-9]+}" matches a segment fully matching the regular expression
+//   - "/static/{path...}" as the last segment captures the rest of the path,
+//     rest with dot segments or encoded slashes doesn't match
+//
+// Path with trailing slash is a different route, see TrailingSlashPolicy
 // - handler: Function to handle requests
-func (s *HTTPRouter) HandlerFunc(method string, path string, handler HTTPHandler) {
+// Returned route can be named for building its URL
+// It panics if the route conflicts with an already registered one
+func (s *HTTPRouter) HandlerFunc(method string, path string, handler HTTPHandler) *Route {
+	return s.handle(nil, method, path, handler)
+}
+
+// handle adds a route for host, nil host serves any host
+func (s *HTTPRouter) handle(host *hostRoutes, method string, path string, handler HTTPHandler) *Route {
 	pathParts := strings.Split(strings.Trim(path, "/"), "/")
-	paramNames := []string{}
+	route := &Route{
+		method:      method,
+		pathParts:   pathParts,
+		handler:     handler,
+		paramNames:  make([]string, len(pathParts)),
+		constraints: make([]*regexp.Regexp, len(pathParts)),
+		router:      s,
+		host:        host,
+		slash:       hasTrailingSlash(path),
+	}
 
-	for _, part := range pathParts {
-		if part[0] == '{' && part[len(part)-1] == '}' {
-			paramNames = append(paramNames, part[1:len(part)-1])
-		} else {
-			paramNames = append(paramNames, "")
+	for i, part := range pathParts {
+		param, err := parseParam(part)
+		if err != nil {
+			panic(fmt.Sprintf("http: invalid route %s %s: %v", method, path, err))
+		}
+		if param == nil {
+			continue
 		}
+
+		if param.catchAll && (i != len(pathParts)-1 || route.slash) {
+			panic(fmt.Sprintf("http: invalid route %s %s: catch-all {%s...} has to be the last segment", method, path, param.name))
+		}
+		for _, other := range append(route.paramNames, host.paramNames()...) {
+			if other == param.name {
+				panic(fmt.Sprintf("http: invalid route %s %s: duplicate parameter {%s}", method, path, param.name))
+			}
+		}
+
+		route.paramNames[i] = param.name
+		route.constraints[i] = param.constraint
+		route.catchAll = param.catchAll
+	}
+
+	if s.trees == nil {
+		s.trees = make(map[string]*node)
+	}
+	trees := s.trees
+	if host != nil {
+		trees = host.trees
+	}
+	root, ok := trees[method]
+	if !ok {
+		root = newNode()
+		trees[method] = root
+	}
+	if err := root.insert(route); err != nil {
+		panic(fmt.Sprintf("http: conflicting route %s %s: %v", method, path, err))
 	}
 
-	s.routes = append(s.routes, Route{
-		method:     method,
-		pathParts:  pathParts,
-		handler:    handler,
-		paramNames: paramNames,
-	})
+	s.routes = append(s.routes, route)
+	return route
 }
 
 // GetHandler returns the HTTP handler that is appropiate for given request
+// Host header and path of the request URL are matched, params hold decoded values
 func (s *HTTPRouter) GetHandler(req *HTTPRequest) HTTPHandler {
-	reqParts := strings.Split(strings.Trim(req.URL, "/"), "/")
+	return s.lookup(req.Method, req)
+}
 
-	for _, route := range s.routes {
-		if req.Method != route.method {
-			continue
+// Use adds middleware that wraps every request served by the router,
+// including 404, 405 and automatic OPTIONS responses
+// Middleware runs before the route is matched, so req.Params are set
+// only for the next handler, the first middleware is the outermost one
+// Use isn't safe to call while the router serves requests
+func (s *HTTPRouter) Use(middleware ...Middleware) {
+	s.middleware = append(s.middleware, middleware...)
+	s.handler = Chain(s.middleware...)(s.dispatch)
+}
+
+// ServeRequest runs the handler registered for req through middleware added by Use
+// - path without any route gets 404 Not Found
+// - path registered for other methods gets 405 Method Not Allowed with Allow header
+// - OPTIONS without own route is answered with Allow header
+// - HEAD without own route runs the GET handler, writer drops the body
+func (s *HTTPRouter) ServeRequest(req *HTTPRequest, w ResponseWriter) {
+	if s.handler != nil {
+		s.handler(req, w)
+		return
+	}
+	s.dispatch(req, w)
+}
+
+// dispatch finds the handler for req or answers on behalf of the router
+func (s *HTTPRouter) dispatch(req *HTTPRequest, w ResponseWriter) {
+	// Client is sent to the canonical path first
+	if location, ok := s.redirectLocation(req); ok {
+		redirect(req, w, location)
+		return
+	}
+
+	if handler := s.GetHandler(req); handler != nil {
+		handler(req, w)
+		return
+	}
+
+	if req.Method == "HEAD" {
+		if handler := s.lookup("GET", req); handler != nil {
+			handler(req, w)
+			return
 		}
+	}
 
-		if len(reqParts) != len(route.pathParts) {
-			continue
+	allowed := s.allowedMethods(req)
+	if len(allowed) == 0 {
+		log.Printf("No handler found for path: %s", req.URL)
+		s.NotFound.orDefault()(req, w, StatusNotFound, fmt.Errorf("%w: %s", ErrNotFound, req.Path))
+		return
+	}
+
+	w.SetHeader("Allow", strings.Join(allowed, ", "))
+	if req.Method == "OPTIONS" {
+		w.WriteHeader(StatusNoContent)
+		return
+	}
+
+	err := fmt.Errorf("%w: %s %s", ErrMethodNotAllowed, req.Method, req.Path)
+	s.MethodNotAllowed.orDefault()(req, w, StatusMethodNotAllowed, err)
+}
+
+// allowedMethods returns sorted methods that have a route for path of req
+// HEAD is allowed with GET and OPTIONS with any method, "*" target
+// gives methods of all routes
+func (s *HTTPRouter) allowedMethods(req *HTTPRequest) []string {
+	rawPath := req.rawPath()
+	reqParts, ok := splitPath(rawPath)
+	if !ok {
+		return nil
+	}
+
+	slash, ignoreSlash := hasTrailingSlash(rawPath), s.TrailingSlash == TrailingSlashIgnore
+	set := make(map[string]bool)
+	for _, hm := range s.matchHosts(req) {
+		for method, root := range hm.trees {
+			if req.URL == "*" || root.match(reqParts, slash, ignoreSlash) != nil {
+				set[method] = true
+			}
 		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	if set["GET"] {
+		set["HEAD"] = true
+	}
+	set["OPTIONS"] = true
 
-		params := make(map[string]string)
-		matches := true
+	allowed := make([]string, 0, len(set))
+	for method := range set {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	return allowed
+}
 
-		for i, routePart := range route.pathParts {
-			if route.paramNames[i] != "" {
-				params[route.paramNames[i]] = reqParts[i]
-			} else if reqParts[i] != routePart {
-				matches = false
+// lookup returns handler for path of req registered under method and sets req.Params
+func (s *HTTPRouter) lookup(method string, req *HTTPRequest) HTTPHandler {
+	return s.lookupPath(method, req, req.rawPath(), s.TrailingSlash == TrailingSlashIgnore)
+}
+
+// lookupPath returns handler for encoded rawPath on host of req registered under method
+// and sets req.Params, ignoreSlash lets routes match with or without trailing slash
+func (s *HTTPRouter) lookupPath(method string, req *HTTPRequest, rawPath string, ignoreSlash bool) HTTPHandler {
+	reqParts, ok := splitPath(rawPath)
+	if !ok {
+		return nil
+	}
+
+	slash := hasTrailingSlash(rawPath)
+	var route *Route
+	var hostParams map[string]string
+	for _, hm := range s.matchHosts(req) {
+		if root, ok := hm.trees[method]; ok {
+			if route = root.match(reqParts, slash, ignoreSlash); route != nil {
+				hostParams = hm.params
 				break
 			}
 		}
+	}
+	if route == nil {
+		return nil
+	}
 
-		if matches {
-			req.Params = params
-			return route.handler
+	params := make(map[string]string, len(route.paramNames)+len(hostParams))
+	for name, value := range hostParams {
+		params[name] = value
+	}
+	for i, name := range route.paramNames {
+		if name == "" {
+			continue
+		}
+		// Catch-all gets the rest of the path with its trailing slash, it may be empty
+		if route.catchAll && i == len(route.paramNames)-1 {
+			if i < len(reqParts) {
+				params[name] = strings.Join(reqParts[i:], "/")
+				if slash {
+					params[name] += "/"
+				}
+			} else {
+				params[name] = ""
+			}
+			continue
 		}
+		params[name] = reqParts[i]
 	}
+	req.Params = params
 
-	return nil
+	return route.handler
+}
+
+// splitPath splits encoded path into percent-decoded segments
+// Segments are split before decoding, so "%2F" stays inside a segment
+func splitPath(rawPath string) ([]string, bool) {
+	parts := strings.Split(strings.Trim(rawPath, "/"), "/")
+	for i, part := range parts {
+		decoded, err := url.PathUnescape(part)
+		if err != nil {
+			return nil, false
+		}
+		parts[i] = decoded
+	}
+	return parts, true
 }
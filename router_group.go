@@ -0,0 +1,113 @@
+package http
+
+import "strings"
+
+// Group registers routes under a common path prefix
+// Middleware of the group wraps every handler registered through it,
+// the first middleware is the outermost one
+type Group struct {
+	router     *HTTPRouter
+	host       *hostRoutes
+	prefix     string
+	middleware []Middleware
+}
+
+// Group returns a group of routes under prefix wrapped with middleware
+func (s *HTTPRouter) Group(prefix string, middleware ...Middleware) *Group {
+	g := &Group{router: s}
+	return g.Group(prefix, middleware...)
+}
+
+// Route creates a group under prefix and calls fn to register its routes
+func (s *HTTPRouter) Route(prefix string, fn func(g *Group), middleware ...Middleware) *Group {
+	g := s.Group(prefix, middleware...)
+	fn(g)
+	return g
+}
+
+// Mount registers all routes of sub under prefix
+// Routes added to sub after mounting aren't visible in s
+func (s *HTTPRouter) Mount(prefix string, sub *HTTPRouter) {
+	g := &Group{router: s}
+	g.Mount(prefix, sub)
+}
+
+// Group returns a nested group, its prefix and middleware follow the ones of g
+func (g *Group) Group(prefix string, middleware ...Middleware) *Group {
+	chain := make([]Middleware, 0, len(g.middleware)+len(middleware))
+	chain = append(chain, g.middleware...)
+	chain = append(chain, middleware...)
+
+	return &Group{
+		router:     g.router,
+		host:       g.host,
+		prefix:     joinPath(g.prefix, prefix),
+		middleware: chain,
+	}
+}
+
+// Route creates a nested group under prefix and calls fn to register its routes
+func (g *Group) Route(prefix string, fn func(g *Group), middleware ...Middleware) *Group {
+	sub := g.Group(prefix, middleware...)
+	fn(sub)
+	return sub
+}
+
+// HandlerFunc adds a route for prefix of the group joined with path
+// It follows the rules of HTTPRouter.HandlerFunc
+func (g *Group) HandlerFunc(method string, path string, handler HTTPHandler) *Route {
+	return g.handle(method, path, handler, nil)
+}
+
+// handle adds a route for handler already wrapped with inner middleware
+func (g *Group) handle(method string, path string, handler HTTPHandler, inner []Middleware) *Route {
+	route := g.router.handle(g.host, method, joinPath(g.prefix, path), Chain(g.middleware...)(handler))
+	route.middleware = append(append([]Middleware{}, g.middleware...), inner...)
+	return route
+}
+
+// Use adds middleware for routes registered through g from now on
+func (g *Group) Use(middleware ...Middleware) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+// Mount registers all routes of sub under prefix of the group
+// Middleware of the group wraps handlers of sub together with middleware added by sub.Use
+// Names of the routes are kept, so sub can't be mounted twice if it has named routes
+// Host routes of sub keep their host unless g has its own
+func (g *Group) Mount(prefix string, sub *HTTPRouter) {
+	mounted := g.Group(prefix, sub.middleware...)
+	for _, route := range sub.routes {
+		target := mounted
+		if route.host != nil && g.host == nil {
+			target = &Group{
+				router:     g.router,
+				host:       g.router.hostRoutes(route.host.pattern),
+				prefix:     mounted.prefix,
+				middleware: mounted.middleware,
+			}
+		}
+		r := target.handle(route.method, route.pattern(), route.handler, route.middleware)
+		if route.name != "" {
+			r.Name(route.name)
+		}
+	}
+}
+
+// joinPath joins route prefix and path with a single slash
+// Trailing slash of path is kept, root path of a group has none
+func joinPath(prefix, path string) string {
+	slash := ""
+	if hasTrailingSlash(path) {
+		slash = "/"
+	}
+	prefix = strings.Trim(prefix, "/")
+	path = strings.Trim(path, "/")
+	switch {
+	case prefix == "":
+		return "/" + path + slash
+	case path == "":
+		return "/" + prefix
+	}
+	return "/" + prefix + "/" + path + slash
+}
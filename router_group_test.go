@@ -0,0 +1,156 @@
+package http
+
+import (
+	"strings"
+	"testing"
+)
+
+// tagMiddleware appends tag to the X-Trace header before calling the handler
+func tagMiddleware(tag string) Middleware {
+	return func(next HTTPHandler) HTTPHandler {
+		return func(r *HTTPRequest, w ResponseWriter) {
+			r.Headers.Add("X-Trace", tag)
+			next(r, w)
+		}
+	}
+}
+
+func TestRouterGroup(t *testing.T) {
+	router := NewHTTPRouter()
+	var trace string
+	handler := func(r *HTTPRequest, w ResponseWriter) {
+		trace = strings.Join(r.Headers.Values("X-Trace"), ",")
+	}
+
+	api := router.Group("/api/", tagMiddleware("api"))
+	api.HandlerFunc("GET", "/status", handler)
+
+	v1 := api.Group("v1", tagMiddleware("v1"), tagMiddleware("auth"))
+	v1.HandlerFunc("GET", "/users/{id}", handler)
+	v1.HandlerFunc("GET", "/", handler)
+
+	router.Route("/admin", func(g *Group) {
+		g.HandlerFunc("POST", "/users", handler)
+		g.Route("/stats", func(g *Group) {
+			g.HandlerFunc("GET", "/", handler)
+		})
+	}, tagMiddleware("admin"))
+
+	router.HandlerFunc("GET", "/plain", handler)
+
+	// Use affects only routes registered afterwards
+	late := router.Group("/late")
+	late.HandlerFunc("GET", "/before", handler)
+	late.Use(tagMiddleware("late"))
+	late.HandlerFunc("GET", "/after", handler)
+
+	tests := []struct {
+		method string
+		url    string
+		trace  string
+	}{
+		{"GET", "/api/status", "api"},
+		{"GET", "/api/v1/users/42", "api,v1,auth"},
+		{"GET", "/api/v1", "api,v1,auth"},
+		{"POST", "/admin/users", "admin"},
+		{"GET", "/admin/stats", "admin"},
+		{"GET", "/plain", ""},
+		{"GET", "/late/before", ""},
+		{"GET", "/late/after", "late"},
+	}
+
+	for _, tt := range tests {
+		req := &HTTPRequest{Method: tt.method, URL: tt.url, Headers: make(Header)}
+		h := router.GetHandler(req)
+		if h == nil {
+			t.Errorf("%s %s: expected handler", tt.method, tt.url)
+			continue
+		}
+		trace = "unset"
+		h(req, nil)
+		if trace != tt.trace {
+			t.Errorf("%s %s: expected middleware %q, got %q", tt.method, tt.url, tt.trace, trace)
+		}
+	}
+
+	req := &HTTPRequest{Method: "GET", URL: "/api/v1/users/42"}
+	router.GetHandler(req)
+	if req.Params["id"] != "42" {
+		t.Errorf("Expected param id to be 42, got %q", req.Params["id"])
+	}
+
+	// Routes of the group are only reachable under the prefix
+	if router.GetHandler(&HTTPRequest{Method: "GET", URL: "/status"}) != nil {
+		t.Error("Expected no handler for /status")
+	}
+}
+
+func TestRouterMount(t *testing.T) {
+	var trace string
+	handler := func(r *HTTPRequest, w ResponseWriter) {
+		trace = strings.Join(r.Headers.Values("X-Trace"), ",") + " " + r.Params["path"]
+	}
+
+	files := NewHTTPRouter()
+	files.Use(tagMiddleware("files"))
+	files.HandlerFunc("GET", "/", handler)
+	files.HandlerFunc("GET", "/{path...}", handler)
+	files.HandlerFunc("DELETE", "/{path...}", handler)
+
+	router := NewHTTPRouter()
+	router.Mount("/files", files)
+	router.Group("/api", tagMiddleware("api")).Mount("/storage", files)
+
+	tests := []struct {
+		method string
+		url    string
+		trace  string
+	}{
+		{"GET", "/files", "files "},
+		{"GET", "/files/docs/a.txt", "files docs/a.txt"},
+		{"DELETE", "/files/a.txt", "files a.txt"},
+		{"GET", "/api/storage/b.txt", "api,files b.txt"},
+	}
+
+	for _, tt := range tests {
+		req := &HTTPRequest{Method: tt.method, URL: tt.url, Headers: make(Header)}
+		h := router.GetHandler(req)
+		if h == nil {
+			t.Errorf("%s %s: expected handler", tt.method, tt.url)
+			continue
+		}
+		h(req, nil)
+		if trace != tt.trace {
+			t.Errorf("%s %s: expected %q, got %q", tt.method, tt.url, tt.trace, trace)
+		}
+	}
+
+	// Mounting twice under the same prefix conflicts
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic mounting routes twice")
+		}
+	}()
+	router.Mount("/files", files)
+}
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		prefix, path, expected string
+	}{
+		{"", "", "/"},
+		{"/", "/", "/"},
+		{"/api", "/", "/api"},
+		{"/api/", "/users", "/api/users"},
+		{"api", "users/{id}", "/api/users/{id}"},
+		{"", "/users", "/users"},
+		{"/api", "/users/", "/api/users/"},
+		{"", "/users/", "/users/"},
+	}
+
+	for _, tt := range tests {
+		if got := joinPath(tt.prefix, tt.path); got != tt.expected {
+			t.Errorf("joinPath(%q, %q) = %q, expected %q", tt.prefix, tt.path, got, tt.expected)
+		}
+	}
+}
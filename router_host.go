@@ -0,0 +1,174 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// hostRoutes holds routes registered for a host pattern
+type hostRoutes struct {
+	pattern     string
+	labels      []string // lowercased static labels, "" for params
+	names       []string // param names, "" for static labels
+	constraints []*regexp.Regexp
+	trees       map[string]*node
+}
+
+// hostMatch is a set of route trees that can serve the request host
+type hostMatch struct {
+	trees  map[string]*node
+	params map[string]string
+}
+
+// Host returns a group of routes served only for requests with matching Host header
+// Pattern is an exact host "api.example.com" or has parameter labels
+// "{sub}.example.com", "{sub:[a-z]+}.example.com" captured to req.Params
+// Port of the Host header is ignored, exact hosts are tried before patterns
+// It panics if the pattern is malformed
+func (s *HTTPRouter) Host(pattern string, middleware ...Middleware) *Group {
+	g := &Group{router: s, host: s.hostRoutes(pattern)}
+	return g.Group("", middleware...)
+}
+
+// hostRoutes returns routes of host pattern, creating them if needed
+func (s *HTTPRouter) hostRoutes(pattern string) *hostRoutes {
+	pattern = strings.TrimSuffix(pattern, ".")
+	for _, h := range s.hosts {
+		if h.pattern == pattern {
+			return h
+		}
+	}
+
+	h, err := parseHost(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("http: invalid host %s: %v", pattern, err))
+	}
+	s.hosts = append(s.hosts, h)
+	return h
+}
+
+// parseHost splits host pattern into labels
+func parseHost(pattern string) (*hostRoutes, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("empty host")
+	}
+
+	parts := strings.Split(pattern, ".")
+	h := &hostRoutes{
+		pattern:     pattern,
+		labels:      make([]string, len(parts)),
+		names:       make([]string, len(parts)),
+		constraints: make([]*regexp.Regexp, len(parts)),
+		trees:       make(map[string]*node),
+	}
+	for i, part := range parts {
+		param, err := parseParam(part)
+		if err != nil {
+			return nil, err
+		}
+		if param == nil {
+			if part == "" {
+				return nil, fmt.Errorf("empty label")
+			}
+			h.labels[i] = strings.ToLower(part)
+			continue
+		}
+
+		if param.catchAll {
+			return nil, fmt.Errorf("catch-all {%s...} isn't allowed in host", param.name)
+		}
+		for _, other := range h.names {
+			if other == param.name {
+				return nil, fmt.Errorf("duplicate parameter {%s}", param.name)
+			}
+		}
+		h.names[i] = param.name
+		h.constraints[i] = param.constraint
+	}
+
+	return h, nil
+}
+
+// paramNames returns names of host parameters, nil host has none
+func (h *hostRoutes) paramNames() []string {
+	if h == nil {
+		return nil
+	}
+	var names []string
+	for _, name := range h.names {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// isExact reports whether the pattern has no parameters
+func (h *hostRoutes) isExact() bool {
+	return len(h.paramNames()) == 0
+}
+
+// match returns captured params if host matches the pattern
+func (h *hostRoutes) match(host string) (map[string]string, bool) {
+	labels := strings.Split(host, ".")
+	if len(labels) != len(h.labels) {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for i, label := range labels {
+		name := h.names[i]
+		if name == "" {
+			if label != h.labels[i] {
+				return nil, false
+			}
+			continue
+		}
+		if label == "" || (h.constraints[i] != nil && !h.constraints[i].MatchString(label)) {
+			return nil, false
+		}
+		params[name] = label
+	}
+	return params, true
+}
+
+// matchHosts returns route trees that can serve req, most specific first
+// Routes serving any host come last
+func (s *HTTPRouter) matchHosts(req *HTTPRequest) []hostMatch {
+	var matches []hostMatch
+	if len(s.hosts) > 0 {
+		matches = s.matchHost(requestHost(req))
+		if len(matches) == 0 && s.DefaultHost != "" {
+			matches = s.matchHost(strings.ToLower(strings.TrimSuffix(s.DefaultHost, ".")))
+		}
+	}
+	return append(matches, hostMatch{trees: s.trees})
+}
+
+// matchHost returns trees of host patterns matching host, exact ones first
+func (s *HTTPRouter) matchHost(host string) []hostMatch {
+	var exact, patterns []hostMatch
+	for _, h := range s.hosts {
+		params, ok := h.match(host)
+		if !ok {
+			continue
+		}
+		if h.isExact() {
+			exact = append(exact, hostMatch{trees: h.trees})
+		} else {
+			patterns = append(patterns, hostMatch{trees: h.trees, params: params})
+		}
+	}
+	return append(exact, patterns...)
+}
+
+// requestHost returns lowercased Host header of req without port
+func requestHost(req *HTTPRequest) string {
+	host := req.Headers.Get("Host")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
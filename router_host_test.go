@@ -0,0 +1,140 @@
+package http
+
+import (
+	"testing"
+)
+
+func TestRouterHost(t *testing.T) {
+	router := NewHTTPRouter()
+	var served string
+	register := func(g *Group, name, path string) {
+		g.HandlerFunc("GET", path, func(r *HTTPRequest, w ResponseWriter) {
+			served = name
+		})
+	}
+
+	register(router.Host("api.example.com"), "api", "/users/{id}")
+	register(router.Host("{tenant}.example.com"), "tenant", "/users/{id}")
+	register(router.Host("{tenant}.example.com"), "tenant dashboard", "/dashboard")
+	register(router.Host("{lang:[a-z]{2}}.docs.example.com"), "docs", "/")
+	register(router.Host("Example.COM"), "main", "/")
+	register(router.Group(""), "any host", "/health")
+	register(router.Group(""), "any host users", "/users/{id}")
+
+	tests := []struct {
+		host   string
+		url    string
+		served string
+		params map[string]string
+	}{
+		{"api.example.com", "/users/1", "api", map[string]string{"id": "1"}},
+		{"API.Example.com:8080", "/users/1", "api", map[string]string{"id": "1"}},
+		{"acme.example.com", "/users/2", "tenant", map[string]string{"tenant": "acme", "id": "2"}},
+		{"acme.example.com", "/dashboard", "tenant dashboard", map[string]string{"tenant": "acme"}},
+		// Exact host has no dashboard, pattern matching the same host does
+		{"api.example.com", "/dashboard", "tenant dashboard", map[string]string{"tenant": "api"}},
+		{"en.docs.example.com", "/", "docs", map[string]string{"lang": "en"}},
+		{"english.docs.example.com", "/", "", nil},
+		{"example.com.", "/", "main", map[string]string{}},
+		// Routes without host serve every host
+		{"acme.example.com", "/health", "any host", map[string]string{}},
+		{"other.org", "/users/3", "any host users", map[string]string{"id": "3"}},
+		{"", "/users/3", "any host users", map[string]string{"id": "3"}},
+		{"other.org", "/dashboard", "", nil},
+		{"[::1]:8080", "/health", "any host", map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		req := &HTTPRequest{Method: "GET", URL: tt.url, Headers: Header{"Host": {tt.host}}}
+		handler := router.GetHandler(req)
+		if tt.served == "" {
+			if handler != nil {
+				t.Errorf("%s%s: expected no handler", tt.host, tt.url)
+			}
+			continue
+		}
+		if handler == nil {
+			t.Errorf("%s%s: expected handler %q", tt.host, tt.url, tt.served)
+			continue
+		}
+
+		served = ""
+		handler(req, nil)
+		if served != tt.served {
+			t.Errorf("%s%s: expected handler %q, got %q", tt.host, tt.url, tt.served, served)
+		}
+		if len(req.Params) != len(tt.params) {
+			t.Errorf("%s%s: expected params %v, got %v", tt.host, tt.url, tt.params, req.Params)
+		}
+		for key, val := range tt.params {
+			if req.Params[key] != val {
+				t.Errorf("%s%s: expected param %s to be %q, got %q", tt.host, tt.url, key, val, req.Params[key])
+			}
+		}
+	}
+
+	t.Run("default host", func(t *testing.T) {
+		router.DefaultHost = "example.com"
+		defer func() { router.DefaultHost = "" }()
+
+		for _, host := range []string{"", "unknown.org"} {
+			req := &HTTPRequest{Method: "GET", URL: "/", Headers: Header{"Host": {host}}}
+			handler := router.GetHandler(req)
+			if handler == nil {
+				t.Errorf("%q: expected handler of the default host", host)
+				continue
+			}
+			handler(req, nil)
+			if served != "main" {
+				t.Errorf("%q: expected main, got %q", host, served)
+			}
+		}
+	})
+
+	t.Run("allowed methods follow host", func(t *testing.T) {
+		router.Host("admin.example.com").HandlerFunc("POST", "/dashboard", func(*HTTPRequest, ResponseWriter) {})
+		req := &HTTPRequest{Method: "PUT", URL: "/dashboard", Headers: Header{"Host": {"acme.example.com"}}}
+		if got := router.allowedMethods(req); len(got) != 3 || got[0] != "GET" {
+			t.Errorf("Expected GET, HEAD, OPTIONS, got %v", got)
+		}
+	})
+}
+
+func TestRouterHostInvalid(t *testing.T) {
+	dummyHandler := func(*HTTPRequest, ResponseWriter) {}
+
+	tests := []struct {
+		name string
+		fn   func(router *HTTPRouter)
+	}{
+		{"empty host", func(router *HTTPRouter) { router.Host("") }},
+		{"empty label", func(router *HTTPRouter) { router.Host("api..example.com") }},
+		{"catch-all label", func(router *HTTPRouter) { router.Host("{sub...}.example.com") }},
+		{"duplicate host param", func(router *HTTPRouter) { router.Host("{a}.{a}.example.com") }},
+		{"host and path param clash", func(router *HTTPRouter) {
+			router.Host("{id}.example.com").HandlerFunc("GET", "/users/{id}", dummyHandler)
+		}},
+		{"conflict within host", func(router *HTTPRouter) {
+			router.Host("api.example.com").HandlerFunc("GET", "/users", dummyHandler)
+			router.Host("api.example.com").HandlerFunc("GET", "/users", dummyHandler)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("Expected panic")
+				}
+			}()
+			tt.fn(NewHTTPRouter())
+		})
+	}
+
+	t.Run("same path on different hosts", func(t *testing.T) {
+		router := NewHTTPRouter()
+		router.Host("a.example.com").HandlerFunc("GET", "/users", dummyHandler)
+		router.Host("b.example.com").HandlerFunc("GET", "/users", dummyHandler)
+		router.HandlerFunc("GET", "/users", dummyHandler)
+	})
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// TrailingSlashPolicy decides how paths differing only in trailing slash are routed
+type TrailingSlashPolicy int
+
+const (
+	// TrailingSlashRedirect redirects to the registered form if the exact one isn't registered,
+	// it's the default
+	TrailingSlashRedirect TrailingSlashPolicy = iota
+
+	// TrailingSlashStrict serves only the exact form, the other one gets 404
+	TrailingSlashStrict
+
+	// TrailingSlashIgnore serves "/users/" with "/users" route and the other way around
+	// if the exact form isn't registered
+	TrailingSlashIgnore
+)
+
+// redirectLocation returns where req should be redirected to
+// Paths that aren't clean are redirected to the clean form,
+// with TrailingSlashRedirect paths registered only with the other form too
+func (s *HTTPRouter) redirectLocation(req *HTTPRequest) (string, bool) {
+	rawPath := req.rawPath()
+	if !strings.HasPrefix(rawPath, "/") {
+		return "", false
+	}
+
+	location := cleanPath(rawPath)
+	if location == rawPath {
+		if s.TrailingSlash != TrailingSlashRedirect || s.routed(req, rawPath) {
+			return "", false
+		}
+		location = toggleTrailingSlash(rawPath)
+		if !s.routed(req, location) {
+			return "", false
+		}
+	}
+
+	if _, query, ok := strings.Cut(req.URL, "?"); ok {
+		location += "?" + query
+	}
+	return location, true
+}
+
+// routed reports whether rawPath has exact route for method of req
+func (s *HTTPRouter) routed(req *HTTPRequest, rawPath string) bool {
+	if s.lookupPath(req.Method, req, rawPath, false) != nil {
+		return true
+	}
+	return req.Method == "HEAD" && s.lookupPath("GET", req, rawPath, false) != nil
+}
+
+// redirect sends client to location
+// GET and HEAD get 301, other methods 308 so they're repeated with the same method and body
+func redirect(req *HTTPRequest, w ResponseWriter, location string) {
+	code := StatusMovedPermanently
+	if req.Method != "GET" && req.Method != "HEAD" {
+		code = StatusPermanentRedirect
+	}
+
+	w.SetHeader("Location", escapeLocation(location))
+	w.SetStatus(code)
+	w.Write([]byte(StatusDescription(code) + "\n"))
+}
+
+// escapeLocation percent-encodes bytes that can't appear in a header value,
+// so the request target can't add headers through Location
+// Backslash and leading "//" are encoded too, browsers would follow "/\host" or "//host" to another host
+func escapeLocation(location string) string {
+	var b strings.Builder
+	for i := 0; i < len(location); i++ {
+		c := location[i]
+		if c <= ' ' || c >= 0x7f || c == '\\' || (i == 1 && c == '/' && location[0] == '/') {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// dotDecoder decodes percent-encoded dots, they are unreserved (RFC 3986 6.2.2.2)
+var dotDecoder = strings.NewReplacer("%2E", ".", "%2e", ".")
+
+// cleanPath returns the canonical form of an encoded path
+// Encoded dots are decoded first, so "%2E%2E" is removed as a dot segment too
+// Dot segments are removed as in RFC 3986 5.2.4 and repeated slashes are collapsed,
+// path ending with slash or dot segment keeps trailing slash
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	p = dotDecoder.Replace(p)
+
+	cleaned := path.Clean(p)
+	if cleaned != "/" && (strings.HasSuffix(p, "/") || strings.HasSuffix(p, "/.") || strings.HasSuffix(p, "/..")) {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// hasTrailingSlash reports whether path other than root ends with slash
+func hasTrailingSlash(path string) bool {
+	return len(path) > 1 && strings.HasSuffix(path, "/")
+}
+
+// toggleTrailingSlash adds trailing slash to path or removes it
+func toggleTrailingSlash(path string) string {
+	if hasTrailingSlash(path) {
+		return strings.TrimSuffix(path, "/")
+	}
+	return path + "/"
+}
@@ -0,0 +1,141 @@
+package http
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		path, expected string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"//", "/"},
+		{"/a/b", "/a/b"},
+		{"/a/b/", "/a/b/"},
+		{"/a//b", "/a/b"},
+		{"//evil.com", "/evil.com"},
+		{"/a/./b", "/a/b"},
+		{"/a/../b", "/b"},
+		{"/a/b/..", "/a/"},
+		{"/a/b/.", "/a/b/"},
+		{"/../a", "/a"},
+		{"/a/%2E%2E/b", "/b"},
+		{"/static/%2e%2e/%2e%2e/etc/passwd", "/etc/passwd"},
+		{"/a/%2e/b/%2E%2e", "/a/"},
+		{"/file%2Etxt", "/file.txt"},
+		{"/a%2Fb/../c", "/c"},
+		{"a/b", "/a/b"},
+	}
+
+	for _, tt := range tests {
+		if got := cleanPath(tt.path); got != tt.expected {
+			t.Errorf("cleanPath(%q) = %q, expected %q", tt.path, got, tt.expected)
+		}
+	}
+}
+
+func TestEscapeLocation(t *testing.T) {
+	tests := []struct {
+		location, expected string
+	}{
+		{"/users?page=2", "/users?page=2"},
+		{"/a\nSet-Cookie:x=1", "/a%0ASet-Cookie:x=1"},
+		{"/\\evil.com/", "/%5Cevil.com/"},
+		{"//evil.com/", "/%2Fevil.com/"},
+		{"/a//b", "/a//b"},
+	}
+
+	for _, tt := range tests {
+		if got := escapeLocation(tt.location); got != tt.expected {
+			t.Errorf("escapeLocation(%q) = %q, expected %q", tt.location, got, tt.expected)
+		}
+	}
+}
+
+func TestDefaultTrailingSlash(t *testing.T) {
+	router := NewHTTPRouter()
+	router.HandlerFunc("GET", "/users", func(r *HTTPRequest, w ResponseWriter) {})
+
+	// "/users/" doesn't silently match "/users"
+	response := writeResponse(t, func(rw *DefaultResponseWriter) {
+		router.ServeRequest(&HTTPRequest{Method: "GET", URL: "/users/"}, rw)
+		rw.Finish()
+	})
+	if !strings.HasPrefix(response, "HTTP/1.1 301 ") || !strings.Contains(response, "\r\nLocation: /users\r\n") {
+		t.Errorf("Expected redirect to /users, got %q", response)
+	}
+}
+
+func TestRouterRedirects(t *testing.T) {
+	dummyHandler := func(r *HTTPRequest, w ResponseWriter) {
+		w.Write([]byte("ok"))
+	}
+	newRouter := func(policy TrailingSlashPolicy) *HTTPRouter {
+		router := NewHTTPRouter()
+		router.TrailingSlash = policy
+		router.HandlerFunc("GET", "/users", dummyHandler)
+		router.HandlerFunc("POST", "/users", dummyHandler)
+		router.HandlerFunc("GET", "/docs/", dummyHandler)
+		router.HandlerFunc("GET", "/both", dummyHandler)
+		router.HandlerFunc("GET", "/both/", dummyHandler)
+		router.HandlerFunc("GET", "/files/{path...}", dummyHandler)
+		return router
+	}
+
+	tests := []struct {
+		name     string
+		policy   TrailingSlashPolicy
+		method   string
+		url      string
+		status   int
+		location string
+	}{
+		{"clean path", TrailingSlashIgnore, "GET", "/users", 200, ""},
+		{"repeated slashes", TrailingSlashIgnore, "GET", "//users", 301, "/users"},
+		{"dot segments keep query", TrailingSlashIgnore, "GET", "/a/../users?page=2", 301, "/users?page=2"},
+		{"dot segments for POST", TrailingSlashIgnore, "POST", "/./users", 308, "/users"},
+		{"unclean path without route", TrailingSlashStrict, "GET", "/a/../nothing", 301, "/nothing"},
+		{"encoded dot segments", TrailingSlashIgnore, "GET", "/files/%2e%2e/%2e%2e/etc/passwd", 301, "/etc/passwd"},
+		{"backslash host escaped", TrailingSlashIgnore, "GET", "/\\evil.com//", 301, "/%5Cevil.com/"},
+		{"control characters escaped", TrailingSlashIgnore, "GET", "//a\nSet-Cookie:x=1", 301, "/a%0ASet-Cookie:x=1"},
+
+		{"ignore adds slash", TrailingSlashIgnore, "GET", "/docs", 200, ""},
+		{"ignore drops slash", TrailingSlashIgnore, "GET", "/users/", 200, ""},
+		{"ignore exact form", TrailingSlashIgnore, "GET", "/both/", 200, ""},
+
+		{"strict without slash", TrailingSlashStrict, "GET", "/users/", 404, ""},
+		{"strict with slash", TrailingSlashStrict, "GET", "/docs", 404, ""},
+		{"strict exact", TrailingSlashStrict, "GET", "/docs/", 200, ""},
+		{"strict catch-all", TrailingSlashStrict, "GET", "/files/a/", 200, ""},
+
+		{"redirect drops slash", TrailingSlashRedirect, "GET", "/users/?q=1", 301, "/users?q=1"},
+		{"redirect adds slash", TrailingSlashRedirect, "GET", "/docs", 301, "/docs/"},
+		{"redirect HEAD", TrailingSlashRedirect, "HEAD", "/docs", 301, "/docs/"},
+		{"redirect POST", TrailingSlashRedirect, "POST", "/users/", 308, "/users"},
+		{"redirect exact form", TrailingSlashRedirect, "GET", "/both", 200, ""},
+		{"redirect only to routed method", TrailingSlashRedirect, "DELETE", "/docs", 404, ""},
+		{"redirect unknown path", TrailingSlashRedirect, "GET", "/nothing/", 404, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newRouter(tt.policy)
+			response := writeResponse(t, func(rw *DefaultResponseWriter) {
+				rw.noBody = tt.method == "HEAD"
+				router.ServeRequest(&HTTPRequest{Method: tt.method, URL: tt.url}, rw)
+				rw.Finish()
+			})
+
+			status := "HTTP/1.1 " + strconv.Itoa(tt.status) + " "
+			if !strings.HasPrefix(response, status) {
+				t.Fatalf("expected status %d, got %q", tt.status, response)
+			}
+			if tt.location != "" && !strings.Contains(response, "\r\nLocation: "+tt.location+"\r\n") {
+				t.Errorf("expected Location %s, got %q", tt.location, response)
+			}
+		})
+	}
+}
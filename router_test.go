@@ -1,6 +1,12 @@
 package http
 
-import "testing"
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
 
 func TestNewHTTPRouter(t *testing.T) {
 	var router *HTTPRouter = NewHTTPRouter()
@@ -56,6 +62,48 @@ func TestHTTPRouter(t *testing.T) {
 				"id": "456",
 			},
 		},
+		{
+			name: "Query string is ignored",
+			req: HTTPRequest{
+				Method: "GET",
+				URL:    "/user/42?verbose=1",
+			},
+			expectHandler: true,
+			expectedParams: map[string]string{
+				"id": "42",
+			},
+		},
+		{
+			name: "Decoded param",
+			req: HTTPRequest{
+				Method: "GET",
+				URL:    "/user/john%20doe",
+			},
+			expectHandler: true,
+			expectedParams: map[string]string{
+				"id": "john doe",
+			},
+		},
+		{
+			name: "Encoded slash stays in param",
+			req: HTTPRequest{
+				Method: "GET",
+				URL:    "/user/a%2Fb",
+			},
+			expectHandler: true,
+			expectedParams: map[string]string{
+				"id": "a/b",
+			},
+		},
+		{
+			name: "Encoded static segment",
+			req: HTTPRequest{
+				Method: "GET",
+				URL:    "/h%65llo",
+			},
+			expectHandler:  true,
+			expectedParams: map[string]string{},
+		},
 		{
 			name: "Method mismatch",
 			req: HTTPRequest{
@@ -102,3 +150,126 @@ func TestHTTPRouter(t *testing.T) {
 		}
 	}
 }
+
+func TestServeRequestMethods(t *testing.T) {
+	router := NewHTTPRouter()
+	router.HandlerFunc("GET", "/users/{id}", func(r *HTTPRequest, w ResponseWriter) {
+		w.SetHeader("X-User", r.Params["id"])
+		w.Write([]byte("user " + r.Params["id"]))
+	})
+	router.HandlerFunc("DELETE", "/users/{id}", func(r *HTTPRequest, w ResponseWriter) {
+		w.WriteHeader(StatusNoContent)
+	})
+	router.HandlerFunc("POST", "/users", func(r *HTTPRequest, w ResponseWriter) {
+		w.SetStatus(StatusCreated)
+	})
+
+	s, port := startTestServer(t, router)
+	defer s.Shutdown()
+
+	sendRequest := func(request string) string {
+		conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		if _, err = conn.Write([]byte(request)); err != nil {
+			t.Fatalf("Failed to write to client connection: %s", err)
+		}
+
+		response, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("failed to read: %s", err)
+		}
+		return string(response)
+	}
+
+	tests := []struct {
+		name    string
+		request string
+		want    string
+	}{
+		{
+			name:    "Method not allowed",
+			request: "PUT /users/42 HTTP/1.1\r\nConnection: close\r\n\r\n",
+			want:    "HTTP/1.1 405 Method Not Allowed\r\nAllow: DELETE, GET, HEAD, OPTIONS\r\nConnection: close\r\nContent-Length: 19\r\nContent-Type: text/plain\r\n\r\nMethod Not Allowed\n",
+		},
+		{
+			name:    "Unknown path",
+			request: "PUT /posts HTTP/1.1\r\nConnection: close\r\n\r\n",
+			want:    "HTTP/1.1 404 Not Found\r\nConnection: close\r\nContent-Length: 10\r\nContent-Type: text/plain\r\n\r\nNot Found\n",
+		},
+		{
+			name:    "Automatic OPTIONS",
+			request: "OPTIONS /users HTTP/1.1\r\nConnection: close\r\n\r\n",
+			want:    "HTTP/1.1 204 No Content\r\nAllow: OPTIONS, POST\r\nConnection: close\r\n\r\n",
+		},
+		{
+			name:    "Server-wide OPTIONS",
+			request: "OPTIONS * HTTP/1.1\r\nConnection: close\r\n\r\n",
+			want:    "HTTP/1.1 204 No Content\r\nAllow: DELETE, GET, HEAD, OPTIONS, POST\r\nConnection: close\r\n\r\n",
+		},
+		{
+			name:    "HEAD runs GET without body",
+			request: "HEAD /users/42 HTTP/1.1\r\nConnection: close\r\n\r\n",
+			want:    "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 7\r\nContent-Type: text/plain\r\nX-User: 42\r\n\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := sendRequest(tt.request); got != tt.want {
+			t.Errorf("%s: expected response %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestRouterUse(t *testing.T) {
+	router := NewHTTPRouter()
+	var trace []string
+	router.HandlerFunc("GET", "/users/{id}", func(r *HTTPRequest, w ResponseWriter) {
+		trace = append(trace, "user "+r.Params["id"])
+		w.Write([]byte("user"))
+	})
+	router.Use(orderMiddleware(&trace, "a"))
+	router.Use(orderMiddleware(&trace, "b"), func(next HTTPHandler) HTTPHandler {
+		return func(r *HTTPRequest, w ResponseWriter) {
+			w.SetHeader("X-Served-By", "router")
+			next(r, w)
+		}
+	})
+
+	tests := []struct {
+		method   string
+		url      string
+		trace    string
+		response string
+	}{
+		{"GET", "/users/42", "a b user 42 /b /a", "HTTP/1.1 200 OK\r\nContent-Length: 4\r\nContent-Type: text/plain\r\nX-Served-By: router\r\n\r\nuser"},
+		{"GET", "/posts", "a b /b /a", "HTTP/1.1 404 Not Found\r\nContent-Length: 10\r\nContent-Type: text/plain\r\nX-Served-By: router\r\n\r\nNot Found\n"},
+		{"PUT", "/users/42", "a b /b /a", "HTTP/1.1 405 Method Not Allowed\r\nAllow: GET, HEAD, OPTIONS\r\nContent-Length: 19\r\nContent-Type: text/plain\r\nX-Served-By: router\r\n\r\nMethod Not Allowed\n"},
+		{"OPTIONS", "/users/42", "a b /b /a", "HTTP/1.1 204 No Content\r\nAllow: GET, HEAD, OPTIONS\r\nX-Served-By: router\r\n\r\n"},
+	}
+
+	for _, tt := range tests {
+		trace = nil
+		got := writeResponse(t, func(rw *DefaultResponseWriter) {
+			router.ServeRequest(&HTTPRequest{Method: tt.method, URL: tt.url}, rw)
+			rw.Finish()
+		})
+		if strings.Join(trace, " ") != tt.trace {
+			t.Errorf("%s %s: expected middleware trace %q, got %q", tt.method, tt.url, tt.trace, strings.Join(trace, " "))
+		}
+		if got != tt.response {
+			t.Errorf("%s %s: expected response %q, got %q", tt.method, tt.url, tt.response, got)
+		}
+	}
+
+	// GetHandler still returns the route handler alone
+	trace = nil
+	req := &HTTPRequest{Method: "GET", URL: "/users/7"}
+	router.GetHandler(req)(req, NewResponseWriter(nil, writeTimeout))
+	if strings.Join(trace, " ") != "user 7" {
+		t.Errorf("Expected GetHandler to skip router middleware, got %q", strings.Join(trace, " "))
+	}
+}
@@ -0,0 +1,214 @@
+package http
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// node is a single path segment in the route tree
+// Every method has its own tree, a path is matched segment by segment
+type node struct {
+	// static children keyed by segment text
+	children map[string]*node
+
+	// param children match a single segment, constrained ones come first
+	params []*node
+
+	// catchAll child matches the rest of the path
+	catchAll *node
+
+	// name and optional constraint of param and catch-all nodes
+	paramName  string
+	constraint *regexp.Regexp
+
+	// routes ending at this node without and with trailing slash
+	route      *Route
+	slashRoute *Route
+}
+
+// newNode returns empty tree node
+func newNode() *node {
+	return &node{children: make(map[string]*node)}
+}
+
+// constraintString returns source of the node constraint or "" if there is none
+func (n *node) constraintString() string {
+	if n.constraint == nil {
+		return ""
+	}
+	return n.constraint.String()
+}
+
+// insert adds route to the tree rooted at n
+// It fails if the same path is already registered or a parameter
+// at the same position with the same constraint has a different name
+func (n *node) insert(route *Route) error {
+	for i, part := range route.pathParts {
+		name := route.paramNames[i]
+		switch {
+		case name == "":
+			child, ok := n.children[part]
+			if !ok {
+				child = newNode()
+				n.children[part] = child
+			}
+			n = child
+		case route.catchAll && i == len(route.pathParts)-1:
+			if n.catchAll == nil {
+				n.catchAll = newNode()
+				n.catchAll.paramName = name
+			} else if n.catchAll.paramName != name {
+				return fmt.Errorf("catch-all {%s...} conflicts with {%s...} registered at the same position", name, n.catchAll.paramName)
+			}
+			n = n.catchAll
+		default:
+			child, err := n.paramChild(name, route.constraints[i])
+			if err != nil {
+				return err
+			}
+			n = child
+		}
+	}
+
+	slot := &n.route
+	if route.slash {
+		slot = &n.slashRoute
+	}
+	if *slot != nil {
+		return fmt.Errorf("route already registered as %s", (*slot).pattern())
+	}
+	*slot = route
+	return nil
+}
+
+// paramChild returns param child with the same constraint, creating it if needed
+func (n *node) paramChild(name string, constraint *regexp.Regexp) (*node, error) {
+	source := ""
+	if constraint != nil {
+		source = constraint.String()
+	}
+
+	for _, child := range n.params {
+		if child.constraintString() != source {
+			continue
+		}
+		if child.paramName != name {
+			return nil, fmt.Errorf("parameter {%s} conflicts with {%s} registered at the same position", name, child.paramName)
+		}
+		return child, nil
+	}
+
+	child := newNode()
+	child.paramName = name
+	child.constraint = constraint
+
+	// Keep unconstrained param last, so constraints are checked first
+	if constraint != nil && len(n.params) > 0 && n.params[len(n.params)-1].constraint == nil {
+		last := len(n.params) - 1
+		n.params = append(n.params[:last], child, n.params[last])
+	} else {
+		n.params = append(n.params, child)
+	}
+	return child, nil
+}
+
+// match returns route for path segments, slash tells if the path has trailing slash
+// Static segments are tried before parameters and parameters before catch-all,
+// the tree is backtracked when a branch doesn't lead to a route
+// With ignoreSlash route registered with the other form matches when the exact one is missing,
+// catch-all matches both forms
+func (n *node) match(parts []string, slash, ignoreSlash bool) *Route {
+	if len(parts) == 0 {
+		exact, other := n.route, n.slashRoute
+		if slash {
+			exact, other = other, exact
+		}
+		if exact != nil {
+			return exact
+		}
+		if ignoreSlash && other != nil {
+			return other
+		}
+		// Catch-all matches an empty rest of the path too
+		if n.catchAll != nil {
+			return n.catchAll.route
+		}
+		return nil
+	}
+
+	if child, ok := n.children[parts[0]]; ok {
+		if route := child.match(parts[1:], slash, ignoreSlash); route != nil {
+			return route
+		}
+	}
+
+	for _, child := range n.params {
+		if child.constraint != nil && !child.constraint.MatchString(parts[0]) {
+			continue
+		}
+		if route := child.match(parts[1:], slash, ignoreSlash); route != nil {
+			return route
+		}
+	}
+
+	if n.catchAll != nil && safeRest(parts) {
+		return n.catchAll.route
+	}
+	return nil
+}
+
+// safeRest reports whether decoded segments can be captured by catch-all
+// Dot segments and encoded slashes would let the value escape its directory
+func safeRest(parts []string) bool {
+	for _, part := range parts {
+		if part == "." || part == ".." || strings.Contains(part, "/") {
+			return false
+		}
+	}
+	return true
+}
+
+// routeParam is a parsed "{name}", "{name:regex}" or "{name...}" path segment
+type routeParam struct {
+	name       string
+	constraint *regexp.Regexp
+	catchAll   bool
+}
+
+// parseParam parses path segment of a route pattern
+// Static segments give nil
+func parseParam(part string) (*routeParam, error) {
+	if !strings.HasPrefix(part, "{") && !strings.HasSuffix(part, "}") {
+		return nil, nil
+	}
+	if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") || len(part) < 3 {
+		return nil, fmt.Errorf("malformed parameter %q", part)
+	}
+
+	p := &routeParam{}
+	inner := part[1 : len(part)-1]
+	name, expr, constrained := strings.Cut(inner, ":")
+	if strings.HasSuffix(name, "...") && !constrained {
+		p.catchAll = true
+		name = strings.TrimSuffix(name, "...")
+	}
+	if name == "" || strings.ContainsAny(name, "{}.") {
+		return nil, fmt.Errorf("malformed parameter %q", part)
+	}
+	p.name = name
+
+	if constrained {
+		if expr == "" {
+			return nil, fmt.Errorf("empty constraint in %q", part)
+		}
+		// Constraint has to match the whole segment
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid constraint in %q: %w", part, err)
+		}
+		p.constraint = re
+	}
+
+	return p, nil
+}
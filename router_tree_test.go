@@ -0,0 +1,304 @@
+package http
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRouteTreePriority(t *testing.T) {
+	router := NewHTTPRouter()
+	handlers := make(map[string]bool)
+	register := func(path string) {
+		router.HandlerFunc("GET", path, func(r *HTTPRequest, w ResponseWriter) {
+			handlers[path] = true
+		})
+	}
+
+	// Param routes registered first still lose to static ones
+	register("/users/{id}")
+	register("/users/{id}/posts")
+	register("/users/me")
+	register("/users/me/settings")
+	register("/")
+
+	tests := []struct {
+		url     string
+		pattern string
+		params  map[string]string
+	}{
+		{"/users/me", "/users/me", map[string]string{}},
+		{"/users/42", "/users/{id}", map[string]string{"id": "42"}},
+		{"/users/me/settings", "/users/me/settings", map[string]string{}},
+		// Static branch has no posts route, tree backtracks to {id}
+		{"/users/me/posts", "/users/{id}/posts", map[string]string{"id": "me"}},
+		{"/", "/", map[string]string{}},
+		{"/users/42/settings", "", nil},
+	}
+
+	for _, tt := range tests {
+		req := &HTTPRequest{Method: "GET", URL: tt.url}
+		handler := router.GetHandler(req)
+		if tt.pattern == "" {
+			if handler != nil {
+				t.Errorf("%s: expected no handler", tt.url)
+			}
+			continue
+		}
+		if handler == nil {
+			t.Errorf("%s: expected handler for %s", tt.url, tt.pattern)
+			continue
+		}
+
+		clear(handlers)
+		handler(req, nil)
+		if !handlers[tt.pattern] {
+			t.Errorf("%s: expected handler for %s, got %v", tt.url, tt.pattern, handlers)
+		}
+		for key, val := range tt.params {
+			if req.Params[key] != val {
+				t.Errorf("%s: expected param %s to be %s, got %s", tt.url, key, val, req.Params[key])
+			}
+		}
+	}
+}
+
+func TestRouteWildcards(t *testing.T) {
+	router := NewHTTPRouter()
+	handlers := make(map[string]bool)
+	register := func(path string) {
+		router.HandlerFunc("GET", path, func(r *HTTPRequest, w ResponseWriter) {
+			handlers[path] = true
+		})
+	}
+
+	register("/users/{id:[0-9]+}")
+	register("/users/{name}")
+	register("/users/{id:[0-9]+}/posts")
+	register("/files/{code:[a-z]{3}}")
+	register("/static/{path...}")
+	register("/static/index.html")
+	register("/static/{dir}/readme")
+
+	tests := []struct {
+		url     string
+		pattern string
+		params  map[string]string
+	}{
+		{"/users/42", "/users/{id:[0-9]+}", map[string]string{"id": "42"}},
+		// Constraint has to match the whole segment
+		{"/users/42abc", "/users/{name}", map[string]string{"name": "42abc"}},
+		{"/users/bob", "/users/{name}", map[string]string{"name": "bob"}},
+		{"/users/42/posts", "/users/{id:[0-9]+}/posts", map[string]string{"id": "42"}},
+		{"/users/bob/posts", "", nil},
+		{"/files/abc", "/files/{code:[a-z]{3}}", map[string]string{"code": "abc"}},
+		{"/files/abcd", "", nil},
+		{"/static/css/site/main.css", "/static/{path...}", map[string]string{"path": "css/site/main.css"}},
+		{"/static/a%20b/c", "/static/{path...}", map[string]string{"path": "a b/c"}},
+		// Catch-all doesn't capture paths leaving its directory
+		{"/static/../etc/passwd", "", nil},
+		{"/static/a/%2e%2e/%2E%2E/etc/passwd", "", nil},
+		{"/static/..%2f..%2fetc/passwd", "", nil},
+		{"/static/a/./b", "", nil},
+		{"/static/index.html", "/static/index.html", map[string]string{}},
+		{"/static/docs/readme", "/static/{dir}/readme", map[string]string{"dir": "docs"}},
+		// Catch-all matches the empty rest of the path too
+		{"/static", "/static/{path...}", map[string]string{"path": ""}},
+		{"/statics/a", "", nil},
+	}
+
+	for _, tt := range tests {
+		req := &HTTPRequest{Method: "GET", URL: tt.url}
+		handler := router.GetHandler(req)
+		if tt.pattern == "" {
+			if handler != nil {
+				t.Errorf("%s: expected no handler", tt.url)
+			}
+			continue
+		}
+		if handler == nil {
+			t.Errorf("%s: expected handler for %s", tt.url, tt.pattern)
+			continue
+		}
+
+		clear(handlers)
+		handler(req, nil)
+		if !handlers[tt.pattern] {
+			t.Errorf("%s: expected handler for %s, got %v", tt.url, tt.pattern, handlers)
+		}
+		if len(req.Params) != len(tt.params) {
+			t.Errorf("%s: expected params %v, got %v", tt.url, tt.params, req.Params)
+		}
+		for key, val := range tt.params {
+			if req.Params[key] != val {
+				t.Errorf("%s: expected param %s to be %q, got %q", tt.url, key, val, req.Params[key])
+			}
+		}
+	}
+}
+
+func TestRouteConflicts(t *testing.T) {
+	dummyHandler := func(*HTTPRequest, ResponseWriter) {}
+
+	tests := []struct {
+		name     string
+		existing []string
+		path     string
+	}{
+		{"duplicate static route", []string{"/users/"}, "/users/"},
+		{"catch-all with trailing slash", nil, "/static/{path...}/"},
+		{"duplicate param route", []string{"/users/{id}"}, "/users/{id}"},
+		{"different param names", []string{"/users/{id}"}, "/users/{name}/posts"},
+		{"duplicate param in route", nil, "/users/{id}/posts/{id}"},
+		{"malformed param", nil, "/users/{id"},
+		{"empty param", nil, "/users/{}"},
+		{"same constraint different names", []string{"/users/{id:[0-9]+}"}, "/users/{num:[0-9]+}/posts"},
+		{"invalid constraint", nil, "/users/{id:[0-9}"},
+		{"empty constraint", nil, "/users/{id:}"},
+		{"catch-all not last", nil, "/static/{path...}/edit"},
+		{"different catch-all names", []string{"/static/{path...}"}, "/static/{file...}"},
+		{"duplicate catch-all route", []string{"/static/{path...}"}, "/static/{path...}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewHTTPRouter()
+			for _, path := range tt.existing {
+				router.HandlerFunc("GET", path, dummyHandler)
+			}
+
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected panic registering %s", tt.path)
+				}
+			}()
+			router.HandlerFunc("GET", tt.path, dummyHandler)
+		})
+	}
+
+	t.Run("same path for another method", func(t *testing.T) {
+		router := NewHTTPRouter()
+		router.HandlerFunc("GET", "/users/{id}", dummyHandler)
+		router.HandlerFunc("POST", "/users/{name}", dummyHandler)
+	})
+
+	t.Run("path with and without trailing slash", func(t *testing.T) {
+		router := NewHTTPRouter()
+		router.HandlerFunc("GET", "/users", dummyHandler)
+		router.HandlerFunc("GET", "/users/", dummyHandler)
+	})
+
+	t.Run("different constraints at the same position", func(t *testing.T) {
+		router := NewHTTPRouter()
+		router.HandlerFunc("GET", "/users/{id:[0-9]+}", dummyHandler)
+		router.HandlerFunc("GET", "/users/{name:[a-z]+}", dummyHandler)
+		router.HandlerFunc("GET", "/users/{other}", dummyHandler)
+	})
+}
+
+// linearRouter is the previous HTTPRouter implementation kept for benchmarks
+// Routes are scanned in registration order
+type linearRouter struct {
+	routes []Route
+}
+
+func (s *linearRouter) HandlerFunc(method string, path string, handler HTTPHandler) *Route {
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	paramNames := []string{}
+
+	for _, part := range pathParts {
+		if part[0] == '{' && part[len(part)-1] == '}' {
+			paramNames = append(paramNames, part[1:len(part)-1])
+		} else {
+			paramNames = append(paramNames, "")
+		}
+	}
+
+	s.routes = append(s.routes, Route{
+		method:     method,
+		pathParts:  pathParts,
+		handler:    handler,
+		paramNames: paramNames,
+	})
+	return &s.routes[len(s.routes)-1]
+}
+
+func (s *linearRouter) GetHandler(req *HTTPRequest) HTTPHandler {
+	reqParts, _ := splitPath(req.rawPath())
+
+	for _, route := range s.routes {
+		if req.Method != route.method {
+			continue
+		}
+
+		if len(reqParts) != len(route.pathParts) {
+			continue
+		}
+
+		params := make(map[string]string)
+		matches := true
+
+		for i, routePart := range route.pathParts {
+			if route.paramNames[i] != "" {
+				params[route.paramNames[i]] = reqParts[i]
+			} else if reqParts[i] != routePart {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			req.Params = params
+			return route.handler
+		}
+	}
+
+	return nil
+}
+
+// benchmarkRouter is implemented by both routers
+type benchmarkRouter interface {
+	HandlerFunc(method string, path string, handler HTTPHandler) *Route
+	GetHandler(req *HTTPRequest) HTTPHandler
+}
+
+// registerAPI registers routes similar to a larger API gateway
+func registerAPI(router benchmarkRouter) {
+	dummyHandler := func(*HTTPRequest, ResponseWriter) {}
+	for i := 0; i < 100; i++ {
+		resource := fmt.Sprintf("/api/v1/resource%d", i)
+		router.HandlerFunc("GET", resource, dummyHandler)
+		router.HandlerFunc("GET", resource+"/{id}", dummyHandler)
+		router.HandlerFunc("POST", resource+"/{id}/items", dummyHandler)
+	}
+}
+
+func benchmarkGetHandler(b *testing.B, router benchmarkRouter, url string) {
+	registerAPI(router)
+	req := &HTTPRequest{Method: "GET", URL: url}
+	if router.GetHandler(req) == nil {
+		b.Fatalf("no handler for %s", url)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.GetHandler(req)
+	}
+}
+
+func BenchmarkTreeRouterFirst(b *testing.B) {
+	benchmarkGetHandler(b, NewHTTPRouter(), "/api/v1/resource0/42")
+}
+
+func BenchmarkLinearRouterFirst(b *testing.B) {
+	benchmarkGetHandler(b, &linearRouter{}, "/api/v1/resource0/42")
+}
+
+func BenchmarkTreeRouterLast(b *testing.B) {
+	benchmarkGetHandler(b, NewHTTPRouter(), "/api/v1/resource99/42")
+}
+
+func BenchmarkLinearRouterLast(b *testing.B) {
+	benchmarkGetHandler(b, &linearRouter{}, "/api/v1/resource99/42")
+}
@@ -0,0 +1,93 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Errors returned while building URL of a named route
+var (
+	ErrRouteNotFound = errors.New("no route with name")
+	ErrMissingParam  = errors.New("missing route parameter")
+	ErrExtraParam    = errors.New("unknown route parameter")
+	ErrInvalidParam  = errors.New("invalid route parameter value")
+)
+
+// URL builds path of the route named name with params filled in
+// Values are percent-encoded, every parameter of the route has to be given
+// and params can't contain names the route doesn't have
+func (s *HTTPRouter) URL(name string, params map[string]string) (string, error) {
+	route, ok := s.names[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrRouteNotFound, name)
+	}
+	return route.URL(params)
+}
+
+// URL builds path of the route with params filled in, following the rules of HTTPRouter.URL
+func (r *Route) URL(params map[string]string) (string, error) {
+	used := 0
+	parts := make([]string, len(r.pathParts))
+	for i, part := range r.pathParts {
+		name := r.paramNames[i]
+		if name == "" {
+			parts[i] = part
+			continue
+		}
+
+		value, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("%w {%s} for %s", ErrMissingParam, name, r.pattern())
+		}
+		used++
+
+		// Catch-all value keeps its slashes, segments are encoded one by one
+		if r.catchAll && i == len(r.pathParts)-1 {
+			segments := strings.Split(strings.Trim(value, "/"), "/")
+			for j, segment := range segments {
+				segments[j] = url.PathEscape(segment)
+			}
+			parts[i] = strings.Join(segments, "/")
+			continue
+		}
+
+		if value == "" {
+			return "", fmt.Errorf("%w: {%s} can't be empty", ErrInvalidParam, name)
+		}
+		if re := r.constraints[i]; re != nil && !re.MatchString(value) {
+			return "", fmt.Errorf("%w: {%s} %q doesn't match %s", ErrInvalidParam, name, value, part)
+		}
+		parts[i] = url.PathEscape(value)
+	}
+
+	if used != len(params) {
+		return "", fmt.Errorf("%w %s for %s", ErrExtraParam, strings.Join(r.extraParams(params), ", "), r.pattern())
+	}
+
+	// Empty catch-all doesn't leave a trailing slash
+	path := strings.TrimSuffix(strings.Join(parts, "/"), "/")
+	if r.slash && path != "" {
+		path += "/"
+	}
+	return "/" + path, nil
+}
+
+// extraParams returns sorted names from params the route doesn't have
+func (r *Route) extraParams(params map[string]string) []string {
+	known := make(map[string]bool, len(r.paramNames))
+	for _, name := range r.paramNames {
+		known[name] = true
+	}
+
+	var extra []string
+	for name := range params {
+		if name == "" || !known[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	return extra
+}
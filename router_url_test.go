@@ -0,0 +1,97 @@
+package http
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRouterURL(t *testing.T) {
+	dummyHandler := func(*HTTPRequest, ResponseWriter) {}
+	router := NewHTTPRouter()
+	router.HandlerFunc("GET", "/", dummyHandler).Name("home")
+	router.HandlerFunc("GET", "/users/{id:[0-9]+}", dummyHandler).Name("user")
+	router.HandlerFunc("GET", "/users/{name}/posts/{slug}", dummyHandler).Name("post")
+	router.HandlerFunc("GET", "/static/{path...}", dummyHandler).Name("static")
+	router.HandlerFunc("GET", "/docs/{section}/", dummyHandler).Name("docs")
+	router.Group("/api/v1").HandlerFunc("GET", "/status", dummyHandler).Name("status")
+
+	tests := []struct {
+		name     string
+		params   map[string]string
+		expected string
+		err      error
+	}{
+		{"home", nil, "/", nil},
+		{"user", map[string]string{"id": "42"}, "/users/42", nil},
+		{"post", map[string]string{"name": "john doe", "slug": "a/b?c#d"}, "/users/john%20doe/posts/a%2Fb%3Fc%23d", nil},
+		{"static", map[string]string{"path": "css/main file.css"}, "/static/css/main%20file.css", nil},
+		{"static", map[string]string{"path": ""}, "/static", nil},
+		{"status", map[string]string{}, "/api/v1/status", nil},
+		{"docs", map[string]string{"section": "intro"}, "/docs/intro/", nil},
+		{"unknown", nil, "", ErrRouteNotFound},
+		{"user", nil, "", ErrMissingParam},
+		{"post", map[string]string{"name": "john"}, "", ErrMissingParam},
+		{"user", map[string]string{"id": "42", "page": "2"}, "", ErrExtraParam},
+		{"home", map[string]string{"id": "42"}, "", ErrExtraParam},
+		{"user", map[string]string{"id": "abc"}, "", ErrInvalidParam},
+		{"post", map[string]string{"name": "", "slug": "x"}, "", ErrInvalidParam},
+	}
+
+	for _, tt := range tests {
+		got, err := router.URL(tt.name, tt.params)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s %v: expected error %v, got %v", tt.name, tt.params, tt.err, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%s %v: expected %q, got %q", tt.name, tt.params, tt.expected, got)
+		}
+	}
+
+	// Built URL is matched by the same route with the same params
+	url, err := router.URL("post", map[string]string{"name": "john doe", "slug": "a/b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &HTTPRequest{Method: "GET", URL: url}
+	if router.GetHandler(req) == nil || req.Params["name"] != "john doe" || req.Params["slug"] != "a/b" {
+		t.Errorf("Expected %s to match post route, got params %v", url, req.Params)
+	}
+}
+
+func TestRouteName(t *testing.T) {
+	dummyHandler := func(*HTTPRequest, ResponseWriter) {}
+
+	t.Run("renaming frees the old name", func(t *testing.T) {
+		router := NewHTTPRouter()
+		route := router.HandlerFunc("GET", "/a", dummyHandler).Name("old")
+		route.Name("new")
+		if _, err := router.URL("old", nil); !errors.Is(err, ErrRouteNotFound) {
+			t.Errorf("Expected old name to be removed, got %v", err)
+		}
+		if url, _ := router.URL("new", nil); url != "/a" {
+			t.Errorf("Expected /a, got %q", url)
+		}
+	})
+
+	t.Run("mounted routes keep names", func(t *testing.T) {
+		sub := NewHTTPRouter()
+		sub.HandlerFunc("GET", "/{id}", dummyHandler).Name("item")
+		router := NewHTTPRouter()
+		router.Mount("/items", sub)
+		if url, err := router.URL("item", map[string]string{"id": "7"}); url != "/items/7" {
+			t.Errorf("Expected /items/7, got %q (%v)", url, err)
+		}
+	})
+
+	t.Run("duplicate name", func(t *testing.T) {
+		router := NewHTTPRouter()
+		router.HandlerFunc("GET", "/a", dummyHandler).Name("page")
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected panic for duplicate route name")
+			}
+		}()
+		router.HandlerFunc("GET", "/b", dummyHandler).Name("page")
+	})
+}
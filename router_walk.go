@@ -0,0 +1,186 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	Method  string `json:"method"`
+	Host    string `json:"host,omitempty"`
+	Pattern string `json:"pattern"`
+	Name    string `json:"name,omitempty"`
+
+	// Params are names of host and path parameters
+	Params []string `json:"params,omitempty"`
+
+	// Middleware are function names of middleware wrapping the route,
+	// the ones added by HTTPRouter.Use come first
+	Middleware []string `json:"middleware,omitempty"`
+
+	Handler HTTPHandler `json:"-"`
+}
+
+// Routes returns routes in registration order
+func (s *HTTPRouter) Routes() []RouteInfo {
+	infos := make([]RouteInfo, 0, len(s.routes))
+	for _, route := range s.routes {
+		infos = append(infos, s.routeInfo(route))
+	}
+	return infos
+}
+
+// Walk calls fn for every route in the route trees and stops at the first error
+// Routes serving any host come first, then hosts in registration order,
+// methods are sorted and paths are visited depth first in matching priority
+func (s *HTTPRouter) Walk(fn func(route RouteInfo) error) error {
+	all := []map[string]*node{s.trees}
+	for _, h := range s.hosts {
+		all = append(all, h.trees)
+	}
+
+	for _, trees := range all {
+		methods := make([]string, 0, len(trees))
+		for method := range trees {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			if err := trees[method].walk(func(route *Route) error {
+				return fn(s.routeInfo(route))
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walk calls fn for routes of the subtree, static children are visited in sorted order
+func (n *node) walk(fn func(route *Route) error) error {
+	for _, route := range []*Route{n.route, n.slashRoute} {
+		if route == nil {
+			continue
+		}
+		if err := fn(route); err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(n.children))
+	for key := range n.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	children := make([]*node, 0, len(keys)+len(n.params)+1)
+	for _, key := range keys {
+		children = append(children, n.children[key])
+	}
+	children = append(children, n.params...)
+	if n.catchAll != nil {
+		children = append(children, n.catchAll)
+	}
+
+	for _, child := range children {
+		if err := child.walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// routeInfo describes route
+func (s *HTTPRouter) routeInfo(route *Route) RouteInfo {
+	info := RouteInfo{
+		Method:  route.method,
+		Pattern: route.pattern(),
+		Name:    route.name,
+		Params:  route.host.paramNames(),
+		Handler: route.handler,
+	}
+	if route.host != nil {
+		info.Host = route.host.pattern
+	}
+	for _, name := range route.paramNames {
+		if name != "" {
+			info.Params = append(info.Params, name)
+		}
+	}
+	for _, mw := range append(append([]Middleware{}, s.middleware...), route.middleware...) {
+		info.Middleware = append(info.Middleware, funcName(mw))
+	}
+	return info
+}
+
+// funcName returns name of function f without the package path
+// Closures are named after the function creating them, e.g. "main.Logger.func1"
+func funcName(f any) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// WriteRouteTable writes routes as an aligned text table
+func WriteRouteTable(w io.Writer, routes []RouteInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tHOST\tPATTERN\tNAME\tPARAMS\tMIDDLEWARE")
+	for _, route := range routes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			route.Method,
+			orDash(route.Host),
+			route.Pattern,
+			orDash(route.Name),
+			orDash(strings.Join(route.Params, ", ")),
+			orDash(strings.Join(route.Middleware, ", ")),
+		)
+	}
+	return tw.Flush()
+}
+
+// WriteRouteJSON writes routes as a JSON array
+func WriteRouteJSON(w io.Writer, routes []RouteInfo) error {
+	if routes == nil {
+		routes = []RouteInfo{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(routes)
+}
+
+// RouteTableHandler returns handler listing routes of s for an admin endpoint
+// Table is sent as JSON for "?format=json" or Accept asking for JSON, as text otherwise
+func (s *HTTPRouter) RouteTableHandler() HTTPHandler {
+	return func(r *HTTPRequest, w ResponseWriter) {
+		routes := s.Routes()
+		if r.Query().Get("format") == "json" || strings.Contains(r.Headers.Get("Accept"), "application/json") {
+			w.SetHeader("Content-Type", "application/json")
+			WriteRouteJSON(w, routes)
+			return
+		}
+		w.SetHeader("Content-Type", "text/plain; charset=utf-8")
+		WriteRouteTable(w, routes)
+	}
+}
+
+// orDash returns s or "-" if it's empty
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
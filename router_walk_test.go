@@ -0,0 +1,172 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func logMiddleware(next HTTPHandler) HTTPHandler {
+	return next
+}
+
+// walkTestRouter returns router with routes on several hosts, groups and a mounted router
+func walkTestRouter() *HTTPRouter {
+	dummyHandler := func(*HTTPRequest, ResponseWriter) {}
+	router := NewHTTPRouter()
+	router.HandlerFunc("POST", "/users", dummyHandler)
+	router.HandlerFunc("GET", "/users/{id}", dummyHandler).Name("user")
+	router.HandlerFunc("GET", "/users/me", dummyHandler)
+	router.HandlerFunc("GET", "/", dummyHandler)
+
+	sub := NewHTTPRouter()
+	sub.Group("", tagMiddleware("sub")).HandlerFunc("GET", "/{path...}", dummyHandler)
+	router.Group("/api", logMiddleware).Mount("/files", sub)
+	router.Host("{tenant}.example.com").HandlerFunc("GET", "/dashboard", dummyHandler)
+	router.Use(tagMiddleware("global"))
+	return router
+}
+
+func TestRoutes(t *testing.T) {
+	routes := walkTestRouter().Routes()
+
+	expected := []string{
+		"POST - /users - -",
+		"GET - /users/{id} user id",
+		"GET - /users/me - -",
+		"GET - / - -",
+		"GET - /api/files/{path...} - path",
+		"GET {tenant}.example.com /dashboard - tenant",
+	}
+	if len(routes) != len(expected) {
+		t.Fatalf("Expected %d routes, got %d", len(expected), len(routes))
+	}
+	for i, route := range routes {
+		got := strings.Join([]string{route.Method, orDash(route.Host), route.Pattern, orDash(route.Name), orDash(strings.Join(route.Params, ","))}, " ")
+		if got != expected[i] {
+			t.Errorf("route %d: expected %q, got %q", i, expected[i], got)
+		}
+		if route.Handler == nil {
+			t.Errorf("route %d: expected handler", i)
+		}
+	}
+
+	// Router middleware comes first, then group middleware from outside in
+	middleware := routes[4].Middleware
+	if len(middleware) != 3 ||
+		!strings.HasPrefix(middleware[0], "http.tagMiddleware") ||
+		middleware[1] != "http.logMiddleware" ||
+		!strings.HasPrefix(middleware[2], "http.tagMiddleware") {
+		t.Errorf("Unexpected middleware %v", middleware)
+	}
+	if len(routes[0].Middleware) != 1 {
+		t.Errorf("Expected only router middleware, got %v", routes[0].Middleware)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	router := walkTestRouter()
+
+	var visited []string
+	err := router.Walk(func(route RouteInfo) error {
+		visited = append(visited, route.Method+" "+route.Host+route.Pattern)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"GET /",
+		"GET /api/files/{path...}",
+		"GET /users/me",
+		"GET /users/{id}",
+		"POST /users",
+		"GET {tenant}.example.com/dashboard",
+	}
+	if strings.Join(visited, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected walk order\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(visited, "\n"))
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = router.Walk(func(route RouteInfo) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("Expected walk to stop at the first error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestWriteRouteTable(t *testing.T) {
+	router := NewHTTPRouter()
+	router.HandlerFunc("GET", "/users/{id}", func(*HTTPRequest, ResponseWriter) {}).Name("user")
+	router.Host("api.example.com").HandlerFunc("DELETE", "/users", func(*HTTPRequest, ResponseWriter) {})
+
+	var buf bytes.Buffer
+	if err := WriteRouteTable(&buf, router.Routes()); err != nil {
+		t.Fatal(err)
+	}
+	expected := "METHOD  HOST             PATTERN      NAME  PARAMS  MIDDLEWARE\n" +
+		"GET     -                /users/{id}  user  id      -\n" +
+		"DELETE  api.example.com  /users       -     -       -\n"
+	if buf.String() != expected {
+		t.Errorf("Expected table\n%s\ngot\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteRouteJSON(&buf, router.Routes()); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Invalid JSON %q: %v", buf.String(), err)
+	}
+	if len(decoded) != 2 || decoded[0]["pattern"] != "/users/{id}" || decoded[0]["name"] != "user" || decoded[1]["host"] != "api.example.com" {
+		t.Errorf("Unexpected JSON %s", buf.String())
+	}
+	if _, ok := decoded[1]["name"]; ok {
+		t.Errorf("Expected empty name to be omitted, got %s", buf.String())
+	}
+
+	buf.Reset()
+	WriteRouteJSON(&buf, nil)
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("Expected empty array, got %q", buf.String())
+	}
+}
+
+func TestRouteTableHandler(t *testing.T) {
+	router := NewHTTPRouter()
+	router.HandlerFunc("GET", "/routes", router.RouteTableHandler())
+
+	tests := []struct {
+		url         string
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"/routes", "", "text/plain; charset=utf-8", "METHOD  HOST  PATTERN  NAME  PARAMS  MIDDLEWARE\nGET     -     /routes  -     -       -\n"},
+		{"/routes?format=json", "", "application/json", "[\n  {\n    \"method\": \"GET\",\n    \"pattern\": \"/routes\"\n  }\n]\n"},
+		{"/routes", "application/json", "application/json", "[\n  {\n    \"method\": \"GET\",\n    \"pattern\": \"/routes\"\n  }\n]\n"},
+	}
+
+	for _, tt := range tests {
+		response := writeResponse(t, func(rw *DefaultResponseWriter) {
+			req := &HTTPRequest{Method: "GET", URL: tt.url, Headers: Header{"Accept": {tt.accept}}}
+			_, req.RawQuery, _ = strings.Cut(tt.url, "?")
+			router.ServeRequest(req, rw)
+			rw.Finish()
+		})
+		head, body, _ := strings.Cut(response, "\r\n\r\n")
+		if !strings.Contains(head+"\r\n", "\r\nContent-Type: "+tt.contentType+"\r\n") {
+			t.Errorf("%s: expected Content-Type %s, got %q", tt.url, tt.contentType, head)
+		}
+		if body != tt.body {
+			t.Errorf("%s: expected body %q, got %q", tt.url, tt.body, body)
+		}
+	}
+}
@@ -1,12 +1,17 @@
 package http
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"os/signal"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -14,19 +19,93 @@ import (
 	"time"
 )
 
+// maxDrainBytes limits how much of an unread request body is discarded
+// to keep the connection alive for the next request
+const maxDrainBytes = 256 << 10
+
+// connState describes what a connection is doing
+type connState int
+
+const (
+	// stateIdle connection waits for the next request
+	stateIdle connState = iota
+	// stateActive connection is reading or serving a request
+	stateActive
+	// stateClosed connection is done
+	stateClosed
+)
+
+// ErrServerClosed is returned by Serve after Shutdown
+var ErrServerClosed = errors.New("server closed")
+
 // Server represents an HTTP server that listens and handles requests
 type Server struct {
 	listenAddr      string
-	listener        net.Listener
-	startch         chan struct{}
+	listeners       []net.Listener
+	handoff         []addrListener // listeners opened for addresses, handed over by Restart
 	running         int32
 	wg              sync.WaitGroup
 	router          *HTTPRouter
 	serverCtx       context.Context
 	cancelFunc      context.CancelFunc
+	mu              sync.Mutex
+	stopped         chan struct{} // closed once Shutdown finished
+	stopOnce        sync.Once
+	conns           map[net.Conn]connState
+	slots           chan struct{}                        // semaphore of MaxConnections size
+	clientConns     map[string]int                       // open connections per client IP
+	rejecting       atomic.Int32                         // rejected connections being answered
+	acceptWait      func(time.Duration) <-chan time.Time // time.After if nil, replaced by tests
 	ReadTimeout     time.Duration
 	WriteTimeout    time.Duration
 	ShutdownTimeout time.Duration
+
+	// IdleTimeout is how long a kept-alive connection waits for the next request
+	IdleTimeout time.Duration
+
+	// MaxRequestsPerConn closes connection after serving that many requests, 0 means no limit
+	MaxRequestsPerConn int
+
+	// MaxConnections limits open connections across all listeners, 0 means no limit
+	// Idle kept-alive connections count too
+	MaxConnections int
+
+	// ConnLimit decides if connections over MaxConnections wait or get 503
+	ConnLimit ConnLimitPolicy
+
+	// MaxConnsPerIP limits open connections from a single client IP, 0 means no limit
+	// Connections over the limit get 429 Too Many Requests
+	MaxConnsPerIP int
+
+	// TLSConfig is used by ListenAndServeTLS, certificates for several hosts are selected by SNI
+	TLSConfig *tls.Config
+
+	// UnixSocketMode sets permissions of socket created for "unix:" address, 0 keeps the umask default
+	UnixSocketMode os.FileMode
+
+	// RestartCommand is the program with arguments started by Restart, os.Args if empty
+	RestartCommand []string
+
+	// RestartOnHangup makes Start and StartTLS call Restart on SIGHUP
+	// instead of letting the signal stop the process
+	RestartOnHangup bool
+
+	// BadRequest responds to requests that couldn't be parsed with 400,
+	// or 501 for unsupported transfer coding, request passed to it is nil
+	BadRequest ErrorHandler
+
+	// RequestTimeout responds with 408 when request didn't arrive within ReadTimeout
+	// Request passed to it is nil
+	RequestTimeout ErrorHandler
+
+	// InternalError responds with 500 when a handler panicked, reason is *PanicError
+	// It's called only if the handler didn't send any part of the response yet
+	InternalError ErrorHandler
+
+	// Overloaded responds with 503 or 429 to connections over the connection limits,
+	// reason wraps ErrTooManyConnections or ErrTooManyClientConnections
+	// Request passed to it is nil
+	Overloaded ErrorHandler
 }
 
 // NewServer returns a new server object
@@ -34,47 +113,91 @@ func NewServer(listenAddr string, router *HTTPRouter) *Server {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Server{
 		listenAddr:      listenAddr,
-		startch:         make(chan struct{}),
 		router:          router,
 		serverCtx:       ctx,
 		cancelFunc:      cancel,
+		conns:           make(map[net.Conn]connState),
 		ReadTimeout:     5 * time.Second,
 		WriteTimeout:    5 * time.Second,
 		ShutdownTimeout: 10 * time.Second,
+		IdleTimeout:     60 * time.Second,
 	}
 }
 
-// Start method starts the server
+// Start listens on the server address and serves until SIGINT or SIGTERM,
+// then shuts the server down gracefully
+// With RestartOnHangup SIGHUP restarts the program handing it the listener, see Restart
 func (s *Server) Start() error {
-	listener, err := net.Listen("tcp", s.listenAddr)
+	ctx, stop := signalContext()
+	defer stop()
+	if s.RestartOnHangup {
+		go s.restartOnHangup(ctx)
+	}
+	return s.ListenAndServe(ctx)
+}
+
+// ListenAndServe listens on the server address and serves until ctx is done
+// or the server is shut down, then shuts it down gracefully and returns nil
+// Address can be TCP address, "unix:/path.sock" or "systemd:" for socket activation
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := s.listen(s.listenAddr)
 	if err != nil {
 		return fmt.Errorf("error starting tcp server: %s", err)
 	}
 
 	fmt.Println("Running tcp server on address:", s.listenAddr)
-	s.listener = listener
+	return s.serveUntil(ctx, listener)
+}
 
-	s.wg.Add(1)
-	go s.acceptLoop()
-	close(s.startch)
+// Serve accepts connections on l until Shutdown, l is closed by the server
+// It can be called for several listeners, ErrServerClosed is returned after Shutdown
+func (s *Server) Serve(l net.Listener) error {
+	if !s.trackListener(l) {
+		l.Close()
+		return ErrServerClosed
+	}
 	s.setRunning(true)
+	// Parent process waits for it to stop its own listeners
+	notifyReady()
 
-	// Wait for a SIGINT or SIGTERM signal to gracefully shut down the server
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	return s.acceptLoop(l)
+}
 
-	log.Println("Shutting down server...")
-	s.Shutdown()
-	log.Println("Server Shutdownped")
+// serveUntil serves l until ctx is done and shuts the server down
+func (s *Server) serveUntil(ctx context.Context, l net.Listener) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Serve(l)
+	}()
 
-	return nil
+	select {
+	case err := <-errc:
+		// Shutdown was called elsewhere, like by Restart, connections are still draining
+		if errors.Is(err, ErrServerClosed) {
+			<-s.stoppedChan()
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+		log.Println("Shutting down server...")
+		s.Shutdown()
+		<-errc
+		log.Println("Server stopped")
+		return nil
+	}
+}
+
+// signalContext returns context cancelled by SIGINT or SIGTERM
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 }
 
 // Shutdown method Shutdowns the server
+// Listeners and idle connections are closed immediately, in-flight requests are allowed to finish
 func (s *Server) Shutdown() {
 	s.cancelFunc()
-	s.listener.Close()
+	s.closeListeners()
+	s.closeIdleConns()
 
 	done := make(chan struct{})
 	go func() {
@@ -88,64 +211,327 @@ func (s *Server) Shutdown() {
 	case <-time.After(s.ShutdownTimeout):
 		log.Println("Timed out waiting for connections to finish")
 	}
+	s.stopOnce.Do(func() { close(s.stoppedChan()) })
+}
+
+// stoppedChan returns channel closed once Shutdown finished
+func (s *Server) stoppedChan() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped == nil {
+		s.stopped = make(chan struct{})
+	}
+	return s.stopped
 }
 
-// acceptLoop method accepts incoming requests
-func (s *Server) acceptLoop() {
+// trackListener registers l to be closed by Shutdown
+// Returns false if the server is already shutting down
+func (s *Server) trackListener(l net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.serverCtx.Err() != nil {
+		return false
+	}
+	// Added under the lock, so Shutdown waits for the accept loop
+	s.wg.Add(1)
+	s.listeners = append(s.listeners, l)
+	return true
+}
+
+// closeListeners stops accepting new connections
+func (s *Server) closeListeners() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, l := range s.listeners {
+		l.Close()
+	}
+}
+
+// acceptLoop accepts connections from l until it's closed
+// Temporary accept errors are retried with growing delay
+func (s *Server) acceptLoop(l net.Listener) error {
 	defer s.wg.Done()
 
+	var delay time.Duration
 	for {
-		select {
-		case <-s.serverCtx.Done():
-			log.Println("Closing accepting loop")
-			return
-		default:
-			conn, err := s.listener.Accept()
-			if err != nil {
-				continue
+		conn, err := l.Accept()
+		if err != nil {
+			if s.serverCtx.Err() != nil {
+				log.Println("Closing accepting loop")
+				return ErrServerClosed
 			}
-			log.Println("New request from:", conn.RemoteAddr())
-			s.wg.Add(1)
-			go s.handleConnection(conn)
+			if !isTemporary(err) {
+				return err
+			}
+
+			delay = nextAcceptDelay(delay)
+			log.Printf("Accept error: %v, retrying in %v", err, delay)
+			wait := time.After
+			if s.acceptWait != nil {
+				wait = s.acceptWait
+			}
+			select {
+			case <-wait(delay):
+			case <-s.serverCtx.Done():
+			}
+			continue
 		}
+		delay = 0
+		log.Println("New request from:", conn.RemoteAddr())
+
+		s.wg.Add(1)
+		if !s.addClientConn(conn) {
+			s.reject(conn, StatusTooManyRequests, fmt.Errorf("%w: %s", ErrTooManyClientConnections, clientIP(conn)))
+			continue
+		}
+
+		// With ConnLimitWait the accepted connection waits for a slot,
+		// following clients wait in the backlog meanwhile
+		block := s.ConnLimit == ConnLimitWait
+		if !s.acceptConnSlot(block) {
+			s.removeClientConn(conn)
+			if block {
+				conn.Close()
+				s.wg.Done()
+				log.Println("Closing accepting loop")
+				return ErrServerClosed
+			}
+			s.reject(conn, StatusServiceUnavailable, fmt.Errorf("%w: limit %d", ErrTooManyConnections, s.MaxConnections))
+			continue
+		}
+		go s.handleConnection(conn)
 	}
 }
 
 // GetPort method return a port of running server
+// Port of the first TCP listener is returned, 0 if there's none
 func (s *Server) GetPort() int {
-	return s.listener.Addr().(*net.TCPAddr).Port
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, l := range s.listeners {
+		if addr, ok := l.Addr().(*net.TCPAddr); ok {
+			return addr.Port
+		}
+	}
+	return 0
 }
 
-// handleConnections handles requests
+// handleConnection serves requests from conn until it's no longer kept alive
 func (s *Server) handleConnection(conn net.Conn) {
-	defer conn.Close()
 	defer s.wg.Done()
+	defer s.releaseConn(conn)
+	defer conn.Close()
+	defer s.setConnState(conn, stateClosed)
 
-	req, err := ParseRequest(conn, s.ReadTimeout)
+	// Reader is kept between requests, so pipelined requests
+	// already read from conn are parsed from its buffer
+	br := bufio.NewReader(conn)
+	for served := 0; ; served++ {
+		// Pipelined request is already buffered, connection isn't idle
+		if br.Buffered() == 0 {
+			if !s.setConnState(conn, stateIdle) {
+				return
+			}
+
+			// Wait for the first byte of the next request
+			timeout := s.IdleTimeout
+			if served == 0 {
+				timeout = s.ReadTimeout
+			}
+			conn.SetReadDeadline(time.Now().Add(timeout))
+			if _, err := br.Peek(1); err != nil {
+				// Only the first request gets 408, idle connections are closed silently
+				if served == 0 && isTimeout(err) {
+					log.Printf("Read timeout %s: %v", conn.RemoteAddr(), err)
+					s.writeError(NewResponseWriter(conn, s.WriteTimeout), nil, StatusRequestTimeout, err)
+				}
+				return
+			}
+		}
+
+		if !s.setConnState(conn, stateActive) {
+			return
+		}
+		if served > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+		}
+
+		if !s.serveRequest(conn, br, served+1) {
+			return
+		}
+	}
+}
+
+// serveRequest reads and handles a single request from br
+// Returns whether the connection can be used for the next request
+func (s *Server) serveRequest(conn net.Conn, br *bufio.Reader, served int) bool {
+	// Head has to arrive within ReadTimeout, body streamed by the handler
+	// gets ReadTimeout for every read, so large uploads aren't cut off
+	req, err := readRequest(br)
 	rw := NewResponseWriter(conn, s.WriteTimeout)
 	if err != nil {
+		// Client closed connection mid request
+		if errors.Is(err, io.EOF) {
+			return false
+		}
 		// Send 408 if read took too long
 		if strings.Contains(err.Error(), "read timeout") {
 			log.Printf("Read timeout %s: %v", conn.RemoteAddr(), err)
-			rw.SetStatus(408)
-			rw.Write([]byte(StatusDescription(408) + "\n"))
-			return
+			s.writeError(rw, nil, StatusRequestTimeout, err)
+			return false
+		}
+		// Send 501 for transfer codings that server can't decode
+		if errors.Is(err, ErrUnsupportedTransferEncoding) {
+			log.Printf("Unsupported transfer encoding %s: %v", conn.RemoteAddr(), err)
+			s.writeError(rw, nil, StatusNotImplemented, err)
+			return false
 		}
 		log.Printf("Failed to parse request from %s: %v", conn.RemoteAddr(), err)
-		rw.SetStatus(400)
-		rw.Write([]byte(StatusDescription(400) + "\n"))
-		return
+		s.writeError(rw, nil, StatusBadRequest, err)
+		return false
 	}
 
 	req.ctx = s.serverCtx
-	handler := s.router.GetHandler(req)
+	req.cleanups = new([]func())
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		req.TLS = &state
+	}
+	reqBody := req.BodyReader.(*body)
+	reqBody.conn, reqBody.timeout = conn, s.ReadTimeout
+	defer reqBody.Close()
+	defer func() {
+		for _, f := range *req.cleanups {
+			f()
+		}
+	}()
 
-	if handler == nil {
-		log.Printf("No handler found for path: %s", req.URL)
-		rw.SetStatus(404)
-		rw.Write([]byte(StatusDescription(404) + "\n"))
-	} else {
-		handler(req, rw)
+	rw.noChunking = req.ProtocolVersion != "HTTP/1.1"
+	rw.noBody = req.Method == "HEAD"
+	rw.closing = func() bool { return s.serverCtx.Err() != nil }
+	keepAlive := s.keepAlive(req, served)
+	if !keepAlive {
+		rw.SetHeader("Connection", "close")
+	} else if req.ProtocolVersion != "HTTP/1.1" {
+		rw.SetHeader("Connection", "keep-alive")
+	}
+
+	if !s.runHandler(req, rw) {
+		return false
+	}
+
+	// Send what handler left in the buffer, client waits for a response
+	// even if handler didn't write one
+	if err := rw.Finish(); err != nil {
+		log.Printf("Failed to finish response to %s: %v", conn.RemoteAddr(), err)
+		return false
+	}
+
+	// Handler may ask to close the connection
+	if !keepAlive || rw.closeRequested() {
+		return false
+	}
+
+	// Unread body has to be consumed before the next request
+	if err := reqBody.discard(maxDrainBytes); err != nil {
+		log.Printf("Closing connection %s: %v", conn.RemoteAddr(), err)
+		return false
+	}
+
+	return true
+}
+
+// keepAlive reports whether the connection is kept open after req
+// HTTP/1.1 persists unless "Connection: close", HTTP/1.0 only with "Connection: keep-alive"
+func (s *Server) keepAlive(req *HTTPRequest, served int) bool {
+	if s.serverCtx.Err() != nil {
+		return false
+	}
+	if s.MaxRequestsPerConn > 0 && served >= s.MaxRequestsPerConn {
+		return false
+	}
+
+	if req.ProtocolVersion != "HTTP/1.1" {
+		return req.Headers.hasToken("Connection", "keep-alive")
+	}
+	return !req.Headers.hasToken("Connection", "close")
+}
+
+// runHandler serves req with the router
+// Panic of the handler is answered with 500 if the response wasn't sent yet
+// Returns false if the handler panicked, connection has to be closed then
+func (s *Server) runHandler(req *HTTPRequest, rw *DefaultResponseWriter) (ok bool) {
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		ok = false
+
+		err := &PanicError{Value: rec, Stack: debug.Stack()}
+		log.Printf("Panic serving %s %s: %v\n%s", req.Method, req.URL, rec, err.Stack)
+		// Client already got part of the response, it can only be cut off
+		if !rw.reset() {
+			return
+		}
+		s.writeError(rw, req, StatusInternalServerError, err)
+	}()
+
+	s.router.ServeRequest(req, rw)
+	return true
+}
+
+// writeError responds with the error handler registered for code,
+// connection is closed afterwards
+func (s *Server) writeError(rw *DefaultResponseWriter, req *HTTPRequest, code int, err error) {
+	var handler ErrorHandler
+	switch code {
+	case StatusRequestTimeout:
+		handler = s.RequestTimeout
+	case StatusInternalServerError:
+		handler = s.InternalError
+	case StatusServiceUnavailable, StatusTooManyRequests:
+		handler = s.Overloaded
+	default:
+		handler = s.BadRequest
+	}
+
+	rw.SetHeader("Connection", "close")
+	handler.orDefault()(req, rw, code, err)
+	rw.Finish()
+}
+
+// setConnState tracks state of conn
+// Returns false if the server is shutting down and conn should be closed
+func (s *Server) setConnState(conn net.Conn, state connState) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state == stateClosed {
+		delete(s.conns, conn)
+		return true
+	}
+	if s.serverCtx.Err() != nil {
+		return false
+	}
+
+	s.conns[conn] = state
+	return true
+}
+
+// closeIdleConns closes connections that wait for the next request
+func (s *Server) closeIdleConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn, state := range s.conns {
+		if state == stateIdle {
+			conn.Close()
+		}
 	}
 }
 
@@ -1,10 +1,16 @@
 package http
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewServer(t *testing.T) {
@@ -21,8 +27,8 @@ func TestNewServer(t *testing.T) {
 		t.Error("Expected router to be the one passed to NewServer")
 	}
 
-	if server.listener != nil {
-		t.Error("Expected listener to be nil initially")
+	if len(server.listeners) != 0 {
+		t.Error("Expected no listeners initially")
 	}
 }
 
@@ -37,8 +43,8 @@ func TestStart(t *testing.T) {
 	}
 	defer conn.Close()
 
-	expected := "HTTP/1.1 404 Not Found\r\nContent-Length: 10\r\nContent-Type: text/plain\r\n\r\nNot Found\n"
-	request := "GET /unknown HTTP/1.1\r\n\r\n"
+	expected := "HTTP/1.1 404 Not Found\r\nConnection: close\r\nContent-Length: 10\r\nContent-Type: text/plain\r\n\r\nNot Found\n"
+	request := "GET /unknown HTTP/1.1\r\nConnection: close\r\n\r\n"
 	// Write the request to the client side
 	_, err = conn.Write([]byte(request))
 	if err != nil {
@@ -94,17 +100,32 @@ func TestHandleConnection(t *testing.T) {
 		{
 			name: "Bad request body",
 			data: "INVALID REQUEST\r\n\r\n",
-			want: "HTTP/1.1 400 Bad Request\r\nContent-Length: 12\r\nContent-Type: text/plain\r\n\r\nBad Request\n",
+			want: "HTTP/1.1 400 Bad Request\r\nConnection: close\r\nContent-Length: 12\r\nContent-Type: text/plain\r\n\r\nBad Request\n",
+		},
+		{
+			name: "Invalid Content-Length",
+			data: "POST /echo HTTP/1.1\r\nContent-Length: -5\r\n\r\n",
+			want: "HTTP/1.1 400 Bad Request\r\nConnection: close\r\nContent-Length: 12\r\nContent-Type: text/plain\r\n\r\nBad Request\n",
+		},
+		{
+			name: "Unknown transfer coding",
+			data: "POST /echo HTTP/1.1\r\nTransfer-Encoding: gzip\r\n\r\n",
+			want: "HTTP/1.1 501 Not Implemented\r\nConnection: close\r\nContent-Length: 16\r\nContent-Type: text/plain\r\n\r\nNot Implemented\n",
+		},
+		{
+			name: "Header injection in target",
+			data: "GET //a\nSet-Cookie:x=1 HTTP/1.1\r\n\r\n",
+			want: "HTTP/1.1 400 Bad Request\r\nConnection: close\r\nContent-Length: 12\r\nContent-Type: text/plain\r\n\r\nBad Request\n",
 		},
 		{
 			name: "Invalid path",
-			data: "GET /unknown HTTP/1.1\r\n\r\n",
-			want: "HTTP/1.1 404 Not Found\r\nContent-Length: 10\r\nContent-Type: text/plain\r\n\r\nNot Found\n",
+			data: "GET /unknown HTTP/1.1\r\nConnection: close\r\n\r\n",
+			want: "HTTP/1.1 404 Not Found\r\nConnection: close\r\nContent-Length: 10\r\nContent-Type: text/plain\r\n\r\nNot Found\n",
 		},
 		{
 			name: "Registered path",
-			data: "GET /echo HTTP/1.1\r\n\r\n",
-			want: "HTTP/1.1 200 OK\r\nContent-Length: 6\r\nContent-Type: text/plain\r\n\r\nHello\n",
+			data: "GET /echo HTTP/1.1\r\nConnection: close\r\n\r\n",
+			want: "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 6\r\nContent-Type: text/plain\r\n\r\nHello\n",
 		},
 	}
 
@@ -120,12 +141,106 @@ func TestGetPort(t *testing.T) {
 	s, port := startTestServer(t, NewHTTPRouter())
 	defer s.Shutdown()
 
-	expected := s.listener.Addr().(*net.TCPAddr).Port
+	expected := s.listeners[0].Addr().(*net.TCPAddr).Port
 	if port != expected {
 		t.Errorf("Port is %d, got %d", expected, port)
 	}
 }
 
+func TestServe(t *testing.T) {
+	router := NewHTTPRouter()
+	router.HandlerFunc("GET", "/ok", func(r *HTTPRequest, w ResponseWriter) {
+		w.Write([]byte("ok"))
+	})
+	s := NewServer(":0", router)
+
+	// Same server accepts connections from several listeners
+	errs := make(chan error, 2)
+	var listeners []net.Listener
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners = append(listeners, l)
+		go func() {
+			errs <- s.Serve(l)
+		}()
+	}
+
+	for _, l := range listeners {
+		// Serve may not have started accepting yet, connection waits in the backlog
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte("GET /ok HTTP/1.1\r\nConnection: close\r\n\r\n"))
+		status, _, body := readResponse(t, bufio.NewReader(conn))
+		if status != "HTTP/1.1 200 OK" || body != "ok" {
+			t.Errorf("Unexpected response %q %q", status, body)
+		}
+		conn.Close()
+	}
+
+	s.Shutdown()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrServerClosed) {
+				t.Errorf("Expected ErrServerClosed, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Serve didn't return after Shutdown")
+		}
+	}
+
+	// Server can't be started again, listener is closed
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Serve(l); !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Expected ErrServerClosed after Shutdown, got %v", err)
+	}
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected listener to be closed, got %v", err)
+	}
+}
+
+func TestListenAndServe(t *testing.T) {
+	s := NewServer("localhost:0", NewHTTPRouter())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ListenAndServe(ctx)
+	}()
+	port := waitForServer(t, s)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected nil after context is cancelled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ListenAndServe didn't return after cancel")
+	}
+	if s.isRunning() {
+		t.Error("Expected server to be stopped")
+	}
+
+	bad := NewServer("localhost:-1", NewHTTPRouter())
+	if err := bad.ListenAndServe(context.Background()); err == nil {
+		t.Error("Expected error for invalid address")
+	}
+}
+
 func TestServerSetAndIsRunning(t *testing.T) {
 	server := &Server{}
 
@@ -146,3 +261,322 @@ func TestServerSetAndIsRunning(t *testing.T) {
 		t.Fatalf("Expected server to not be running, but got running=true")
 	}
 }
+
+// readResponse reads a single response with Content-Length body from br
+func readResponse(t *testing.T, br *bufio.Reader) (string, map[string]string, string) {
+	t.Helper()
+
+	status, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read status line: %s", err)
+	}
+
+	headers := make(map[string]string)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read header: %s", err)
+		}
+		if line == CRLF {
+			break
+		}
+		key, value, _ := strings.Cut(strings.TrimSuffix(line, CRLF), ": ")
+		headers[key] = value
+	}
+
+	length, _ := strconv.Atoi(headers["Content-Length"])
+	body := make([]byte, length)
+	if _, err := io.ReadFull(br, body); err != nil {
+		t.Fatalf("failed to read body: %s", err)
+	}
+
+	return strings.TrimSuffix(status, CRLF), headers, string(body)
+}
+
+func TestKeepAlive(t *testing.T) {
+	router := NewHTTPRouter()
+	router.HandlerFunc("POST", "/echo", BufferBody(func(r *HTTPRequest, w ResponseWriter) {
+		w.Write(r.Body)
+	}, 1024))
+	router.HandlerFunc("POST", "/ignore", func(r *HTTPRequest, w ResponseWriter) {
+		w.Write([]byte("ignored"))
+	})
+
+	s, port := startTestServer(t, router, func(s *Server) {
+		s.MaxRequestsPerConn = 3
+	})
+	defer s.Shutdown()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	// Unread body is discarded before the next request
+	requests := []struct {
+		data       string
+		body       string
+		connection string
+	}{
+		{"POST /echo HTTP/1.1\r\nContent-Length: 5\r\n\r\nfirst", "first", ""},
+		{"POST /ignore HTTP/1.1\r\nContent-Length: 6\r\n\r\nsecond", "ignored", ""},
+		{"POST /echo HTTP/1.1\r\nContent-Length: 5\r\n\r\nthird", "third", "close"},
+	}
+
+	for _, req := range requests {
+		if _, err := conn.Write([]byte(req.data)); err != nil {
+			t.Fatalf("Failed to write to client connection: %s", err)
+		}
+
+		status, headers, body := readResponse(t, br)
+		if status != "HTTP/1.1 200 OK" {
+			t.Errorf("Expected status 200, got %q", status)
+		}
+		if body != req.body {
+			t.Errorf("Expected body %q, got %q", req.body, body)
+		}
+		if headers["Connection"] != req.connection {
+			t.Errorf("Expected Connection header %q, got %q", req.connection, headers["Connection"])
+		}
+	}
+
+	// MaxRequestsPerConn reached, server closes connection
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Errorf("Expected EOF after last request, got %v", err)
+	}
+}
+
+func TestKeepAliveHTTP10(t *testing.T) {
+	router := NewHTTPRouter()
+	router.HandlerFunc("GET", "/ok", func(r *HTTPRequest, w ResponseWriter) {
+		w.Write([]byte("ok"))
+	})
+
+	s, port := startTestServer(t, router)
+	defer s.Shutdown()
+
+	t.Run("closed by default", func(t *testing.T) {
+		conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("GET /ok HTTP/1.0\r\n\r\n"))
+		response, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("failed to read: %s", err)
+		}
+
+		expected := "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 2\r\nContent-Type: text/plain\r\n\r\nok"
+		if string(response) != expected {
+			t.Errorf("expected %q, but got %q", expected, response)
+		}
+	})
+
+	t.Run("kept alive on request", func(t *testing.T) {
+		conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+
+		for i := 0; i < 2; i++ {
+			conn.Write([]byte("GET /ok HTTP/1.0\r\nConnection: keep-alive\r\n\r\n"))
+			_, headers, body := readResponse(t, br)
+			if headers["Connection"] != "keep-alive" || body != "ok" {
+				t.Errorf("Expected kept-alive ok response, got %v %q", headers, body)
+			}
+		}
+	})
+}
+
+func TestIdleTimeout(t *testing.T) {
+	s, port := startTestServer(t, NewHTTPRouter(), func(s *Server) {
+		s.IdleTimeout = 50 * time.Millisecond
+	})
+	defer s.Shutdown()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	conn.Write([]byte("GET /unknown HTTP/1.1\r\n\r\n"))
+	readResponse(t, br)
+
+	// Idle connection is closed without a response
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Errorf("Expected EOF after idle timeout, got %v", err)
+	}
+}
+
+func TestShutdownConnections(t *testing.T) {
+	router := NewHTTPRouter()
+	started := make(chan struct{})
+	router.HandlerFunc("GET", "/slow", func(r *HTTPRequest, w ResponseWriter) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	s, port := startTestServer(t, router)
+
+	idle, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	idleReader := bufio.NewReader(idle)
+	idle.Write([]byte("GET /unknown HTTP/1.1\r\n\r\n"))
+	readResponse(t, idleReader)
+
+	busy, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busy.Write([]byte("GET /slow HTTP/1.1\r\n\r\n"))
+	<-started
+
+	s.Shutdown()
+
+	// Idle connection is closed right away
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := idleReader.ReadByte(); err != io.EOF {
+		t.Errorf("Expected idle connection to be closed, got %v", err)
+	}
+
+	// In-flight request finishes and tells the client the connection is closed after it
+	response, err := io.ReadAll(busy)
+	if err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	expected := "HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 4\r\nContent-Type: text/plain\r\n\r\ndone"
+	if string(response) != expected {
+		t.Errorf("expected %q, but got %q", expected, response)
+	}
+}
+
+func TestPipelining(t *testing.T) {
+	router := NewHTTPRouter()
+	router.HandlerFunc("POST", "/echo", BufferBody(func(r *HTTPRequest, w ResponseWriter) {
+		w.Write(r.Body)
+	}, 1024))
+	router.HandlerFunc("GET", "/slow", func(r *HTTPRequest, w ResponseWriter) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("slow"))
+	})
+
+	s, port := startTestServer(t, router)
+	defer s.Shutdown()
+
+	t.Run("responses in order", func(t *testing.T) {
+		conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		// Send three requests in one write
+		requests := "GET /slow HTTP/1.1\r\n\r\n" +
+			"POST /echo HTTP/1.1\r\nContent-Length: 4\r\n\r\nfast" +
+			"POST /echo HTTP/1.1\r\nTransfer-Encoding: chunked\r\nConnection: close\r\n\r\n4\r\nlast\r\n0\r\n\r\n"
+		if _, err := conn.Write([]byte(requests)); err != nil {
+			t.Fatalf("Failed to write to client connection: %s", err)
+		}
+
+		response, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("failed to read: %s", err)
+		}
+
+		expected := "HTTP/1.1 200 OK\r\nContent-Length: 4\r\nContent-Type: text/plain\r\n\r\nslow" +
+			"HTTP/1.1 200 OK\r\nContent-Length: 4\r\nContent-Type: text/plain\r\n\r\nfast" +
+			"HTTP/1.1 200 OK\r\nConnection: close\r\nContent-Length: 4\r\nContent-Type: text/plain\r\n\r\nlast"
+		if string(response) != expected {
+			t.Errorf("expected %q, but got %q", expected, response)
+		}
+	})
+
+	t.Run("bad request stops pipeline", func(t *testing.T) {
+		conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		requests := "POST /echo HTTP/1.1\r\nContent-Length: 2\r\n\r\nok" +
+			"INVALID\r\n\r\n" +
+			"POST /echo HTTP/1.1\r\nContent-Length: 5\r\n\r\nnever"
+		if _, err := conn.Write([]byte(requests)); err != nil {
+			t.Fatalf("Failed to write to client connection: %s", err)
+		}
+
+		response, err := io.ReadAll(conn)
+		if err != nil {
+			t.Fatalf("failed to read: %s", err)
+		}
+
+		expected := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nContent-Type: text/plain\r\n\r\nok" +
+			"HTTP/1.1 400 Bad Request\r\nConnection: close\r\nContent-Length: 12\r\nContent-Type: text/plain\r\n\r\nBad Request\n"
+		if string(response) != expected {
+			t.Errorf("expected %q, but got %q", expected, response)
+		}
+	})
+}
+
+func TestStreamingResponse(t *testing.T) {
+	router := NewHTTPRouter()
+	proceed := make(chan struct{})
+	router.HandlerFunc("GET", "/stream", func(r *HTTPRequest, w ResponseWriter) {
+		w.Write([]byte("first"))
+		w.Flush()
+		<-proceed
+		w.Write([]byte("second"))
+	})
+
+	s, port := startTestServer(t, router)
+	defer s.Shutdown()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	conn.Write([]byte("GET /stream HTTP/1.1\r\n\r\n"))
+
+	// Flushed part arrives while handler still runs
+	head := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nfirst\r\n"
+	got := make([]byte, len(head))
+	if _, err := io.ReadFull(br, got); err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	if string(got) != head {
+		t.Errorf("expected %q, but got %q", head, got)
+	}
+	close(proceed)
+
+	// Connection stays usable after the last chunk
+	rest := "6\r\nsecond\r\n0\r\n\r\n"
+	got = make([]byte, len(rest))
+	if _, err := io.ReadFull(br, got); err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	if string(got) != rest {
+		t.Errorf("expected %q, but got %q", rest, got)
+	}
+
+	conn.Write([]byte("GET /unknown HTTP/1.1\r\n\r\n"))
+	if status, _, _ := readResponse(t, br); status != "HTTP/1.1 404 Not Found" {
+		t.Errorf("Expected 404 on kept-alive connection, got %q", status)
+	}
+}
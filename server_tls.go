@@ -0,0 +1,82 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+)
+
+// StartTLS serves HTTPS on the server address until SIGINT or SIGTERM,
+// then shuts the server down gracefully, RestartOnHangup applies like in Start
+func (s *Server) StartTLS(certFile, keyFile string) error {
+	ctx, stop := signalContext()
+	defer stop()
+	if s.RestartOnHangup {
+		go s.restartOnHangup(ctx)
+	}
+	return s.ListenAndServeTLS(ctx, certFile, keyFile)
+}
+
+// ListenAndServeTLS serves HTTPS on the server address until ctx is done
+// certFile and keyFile are added to certificates of TLSConfig,
+// they can be empty if TLSConfig already has certificates
+func (s *Server) ListenAndServeTLS(ctx context.Context, certFile, keyFile string) error {
+	config, err := s.tlsConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	listener, err := s.listen(s.listenAddr)
+	if err != nil {
+		return fmt.Errorf("error starting tls server: %s", err)
+	}
+
+	fmt.Println("Running tls server on address:", s.listenAddr)
+	return s.serveUntil(ctx, tls.NewListener(listener, config))
+}
+
+// AddCertificate loads certificate and key from PEM files and adds them to TLSConfig
+// Client gets the certificate matching the server name it sent (SNI),
+// the first certificate is used for clients not sending any
+func (s *Server) AddCertificate(certFile, keyFile string) error {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	if s.TLSConfig == nil {
+		s.TLSConfig = &tls.Config{}
+	}
+	s.TLSConfig.Certificates = append(s.TLSConfig.Certificates, cert)
+	return nil
+}
+
+// tlsConfig returns copy of TLSConfig with certFile and keyFile loaded
+func (s *Server) tlsConfig(certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %w", err)
+		}
+		config.Certificates = append(config.Certificates, cert)
+	}
+
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, errors.New("tls: no certificates configured")
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	// Server speaks only HTTP/1.1
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"http/1.1"}
+	}
+
+	return config, nil
+}
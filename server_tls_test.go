@@ -0,0 +1,160 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes self-signed certificate for host and its key to dir
+func writeTestCert(t *testing.T, dir, host string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: host},
+		DNSNames:              []string{host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, host+".crt")
+	keyFile = filepath.Join(dir, host+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestStartTLS(t *testing.T) {
+	dir := t.TempDir()
+	certA, keyA, parsedA := writeTestCert(t, dir, "a.test")
+	certB, keyB, parsedB := writeTestCert(t, dir, "b.test")
+
+	router := NewHTTPRouter()
+	router.HandlerFunc("GET", "/tls", func(r *HTTPRequest, w ResponseWriter) {
+		if r.TLS == nil {
+			w.Write([]byte("plain"))
+			return
+		}
+		w.Write([]byte(fmt.Sprintf("%s %s", r.TLS.ServerName, r.TLS.NegotiatedProtocol)))
+	})
+
+	s := NewServer("localhost:0", router)
+	if err := s.AddCertificate(certA, keyA); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ListenAndServeTLS(ctx, certB, keyB)
+	}()
+	port := waitForServer(t, s)
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Expected clean shutdown, got %v", err)
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(parsedA)
+	roots.AddCert(parsedB)
+
+	tests := []struct {
+		serverName string
+		expected   *x509.Certificate
+	}{
+		{"a.test", parsedA},
+		{"b.test", parsedB},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.serverName, func(t *testing.T) {
+			conn, err := tls.Dial("tcp", fmt.Sprintf("localhost:%d", port), &tls.Config{
+				ServerName: tt.serverName,
+				RootCAs:    roots,
+				NextProtos: []string{"http/1.1"},
+			})
+			if err != nil {
+				t.Fatalf("Handshake failed: %v", err)
+			}
+			defer conn.Close()
+
+			if peer := conn.ConnectionState().PeerCertificates[0]; !peer.Equal(tt.expected) {
+				t.Errorf("Expected certificate for %s, got %v", tt.serverName, peer.DNSNames)
+			}
+
+			if _, err := conn.Write([]byte("GET /tls HTTP/1.1\r\nHost: " + tt.serverName + "\r\n\r\n")); err != nil {
+				t.Fatal(err)
+			}
+			status, _, body := readResponse(t, bufio.NewReader(conn))
+			if status != "HTTP/1.1 200 OK" || body != tt.serverName+" http/1.1" {
+				t.Errorf("Unexpected response %q %q", status, body)
+			}
+		})
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeTestCert(t, dir, "a.test")
+
+	s := NewServer(":0", NewHTTPRouter())
+	if _, err := s.tlsConfig("", ""); err == nil {
+		t.Error("Expected error without certificates")
+	}
+	if _, err := s.tlsConfig(certFile, filepath.Join(dir, "missing.key")); err == nil {
+		t.Error("Expected error for missing key")
+	}
+	if err := s.AddCertificate(filepath.Join(dir, "missing.crt"), keyFile); err == nil {
+		t.Error("Expected error for missing certificate")
+	}
+
+	s.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS13}
+	config, err := s.tlsConfig(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.MinVersion != tls.VersionTLS13 || len(config.Certificates) != 1 || config.NextProtos[0] != "http/1.1" {
+		t.Errorf("Unexpected config %+v", config)
+	}
+	// Server's config isn't modified
+	if len(s.TLSConfig.Certificates) != 0 {
+		t.Error("Expected TLSConfig to stay unchanged")
+	}
+}
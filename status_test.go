@@ -0,0 +1,62 @@
+package http
+
+import "testing"
+
+func TestStatusDescription(t *testing.T) {
+	tests := []struct {
+		input    int
+		expected string
+	}{
+		{200, "OK"},
+		{201, "Created"},
+		{400, "Bad Request"},
+		{404, "Not Found"},
+		{408, "Request Timeout"},
+		{413, "Content Too Large"},
+		{500, "Internal Server Error"},
+		{501, "Not Implemented"},
+		{504, "Gateway Timeout"},
+		{204, "No Content"},
+		{301, "Moved Permanently"},
+		{401, "Unauthorized"},
+		{403, "Forbidden"},
+		{405, "Method Not Allowed"},
+		{429, "Too Many Requests"},
+		{503, "Service Unavailable"},
+		{199, "Informational"},
+		{299, "Success"},
+		{399, "Redirection"},
+		{499, "Client Error"},
+		{599, "Server Error"},
+		{99, ""},
+		{600, ""},
+		{1337, ""},
+	}
+
+	for _, v := range tests {
+		if got := StatusDescription(v.input); got != v.expected {
+			t.Errorf("Failed test [%d], want %s got %s\n", v.input, v.expected, got)
+		}
+	}
+}
+
+func TestBodyAllowedForStatus(t *testing.T) {
+	tests := []struct {
+		code    int
+		allowed bool
+	}{
+		{100, false},
+		{101, false},
+		{200, true},
+		{204, false},
+		{301, true},
+		{304, false},
+		{404, true},
+	}
+
+	for _, v := range tests {
+		if got := bodyAllowedForStatus(v.code); got != v.allowed {
+			t.Errorf("Failed test [%d], want %v got %v\n", v.code, v.allowed, got)
+		}
+	}
+}
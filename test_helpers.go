@@ -1,25 +1,43 @@
 package http
 
 import (
+	"errors"
+	"net"
 	"testing"
 	"time"
 )
 
 // startTestServer starts a test server and returns it along with the port it is running on
-func startTestServer(t *testing.T, router *HTTPRouter) (*Server, int) {
+// Options are applied to the server before it starts
+func startTestServer(t *testing.T, router *HTTPRouter, opts ...func(*Server)) (*Server, int) {
 	s := NewServer(":0", router)
+	for _, opt := range opts {
+		opt(s)
+	}
 
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
 	go func() {
-		if err := s.Start(); err != nil {
-			t.Errorf("Failed to start server: %v", err)
+		if err := s.Serve(listener); err != nil && !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Failed to serve: %v", err)
 		}
 	}()
 
-	select {
-	case <-s.startch:
-		return s, s.GetPort()
-	case <-time.After(500 * time.Millisecond):
-		t.Fatal("Server did not start")
-		return nil, 0
+	return s, waitForServer(t, s)
+}
+
+// waitForServer waits until s listens on a TCP port and returns it
+func waitForServer(t *testing.T, s *Server) int {
+	t.Helper()
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if port := s.GetPort(); port != 0 {
+			return port
+		}
+		time.Sleep(time.Millisecond)
 	}
+	t.Fatal("Server did not start")
+	return 0
 }